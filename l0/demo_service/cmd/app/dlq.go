@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	kafkain "demo_service/internal/adapters/inbound/kafka"
+	"demo_service/internal/app/config"
+)
+
+const dlqUsage = `usage: app dlq <command> [flags]
+
+commands:
+  inspect [-n 20] [-values]      list dead-lettered messages without consuming them
+  redrive [-n N] [-to TOPIC]     publish dead-lettered messages back to their
+                                 original topic (or TOPIC) and commit them
+`
+
+// runDLQ implements the dlq subcommand for the topic set in KAFKA_DLQ_TOPIC.
+func runDLQ(ctx context.Context, args []string) error {
+	cfg, err := config.LoadKafka()
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if cfg.KafkaDLQTopic == "" {
+		return errors.New("KAFKA_DLQ_TOPIC is not set")
+	}
+	conn, err := kafkaConn(cfg)
+	if err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, dlqUsage)
+		return errors.New("missing command")
+	}
+
+	switch args[0] {
+	case "inspect":
+		fset := flag.NewFlagSet("dlq inspect", flag.ContinueOnError)
+		limit := fset.Int("n", 20, "max messages to show (0 = all)")
+		values := fset.Bool("values", false, "print message payloads")
+		if err := fset.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PARTITION\tOFFSET\tFAILED AT\tSOURCE\tCLASS\tKEY\tERROR")
+		err := kafkain.InspectDeadLetters(ctx, cfg.KafkaBrokers, conn, cfg.KafkaDLQTopic, *limit, func(d kafkain.DeadLetter) {
+			fmt.Fprintf(tw, "%d\t%d\t%s\t%s/%d@%d\t%s\t%s\t%s\n",
+				d.Partition, d.Offset, d.FailedAt, d.OriginalTopic, d.OriginalPartition, d.OriginalOffset,
+				d.ErrorClass, string(d.Key), d.ErrorMessage)
+			if *values {
+				fmt.Fprintf(tw, "\t\t\t\t\t\t%s\n", string(d.Value))
+			}
+		})
+		if ferr := tw.Flush(); err == nil {
+			err = ferr
+		}
+		return err
+
+	case "redrive":
+		fset := flag.NewFlagSet("dlq redrive", flag.ContinueOnError)
+		limit := fset.Int("n", 0, "max messages to re-drive (0 = all)")
+		target := fset.String("to", "", "target topic (default: the message's original topic)")
+		if err := fset.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		n, err := kafkain.Redrive(ctx, kafkain.RedriveConfig{
+			Brokers:         cfg.KafkaBrokers,
+			Conn:            conn,
+			DeadLetterTopic: cfg.KafkaDLQTopic,
+			GroupID:         cfg.KafkaConsumerGroup + "-dlq-redrive",
+			Target:          *target,
+			Limit:           *limit,
+		})
+		fmt.Printf("re-drove %d message(s)\n", n)
+		return err
+	}
+
+	fmt.Fprint(os.Stderr, dlqUsage)
+	return fmt.Errorf("unknown command %q", args[0])
+}
@@ -2,43 +2,65 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io/fs"
 	"log"
+	"os"
 	"time"
 
 	httpin "demo_service/internal/adapters/inbound/http"
 	kafkain "demo_service/internal/adapters/inbound/kafka"
+	"demo_service/internal/adapters/kafkaconn"
 	"demo_service/internal/adapters/outbound/cache"
+	kafkaout "demo_service/internal/adapters/outbound/kafka"
+	"demo_service/internal/adapters/outbound/memory"
 	"demo_service/internal/adapters/outbound/postgres"
+	"demo_service/internal/adapters/outbound/sqlite"
+	"demo_service/internal/adapters/outbound/traced"
 	"demo_service/internal/app/config"
 	"demo_service/internal/app/runtime"
 	"demo_service/internal/core/service"
+	"demo_service/internal/core/trace"
+	"demo_service/internal/migrations"
+	"demo_service/internal/ports/outbound"
 )
 
 func main() {
 	ctx, stop := runtime.NotifyContext(context.Background())
 	defer stop()
 
-	cfg, err := config.Load()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if err := runMigrate(ctx, os.Args[2:]); err != nil {
+				log.Fatalf("migrate: %v", err)
+			}
+			return
+		case "dlq":
+			if err := runDLQ(ctx, os.Args[2:]); err != nil {
+				log.Fatalf("dlq: %v", err)
+			}
+			return
+		}
+	}
+
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
 		log.Fatalf("config: %v", err)
 	}
 
-	db, err := postgres.New(ctx, cfg.DatabaseURL)
-	if err != nil {
-		log.Fatalf("db init: %v", err)
+	if err := trace.SetSpanLogging(cfg.TraceSpans); err != nil {
+		log.Fatalf("trace: %v", err)
 	}
-	defer db.Close()
 
-	// migrations
-	migCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-	if err := postgres.RunMigrations(migCtx, db.Pool, cfg.MigrationsDir); err != nil {
-		log.Fatalf("migrations: %v", err)
+	store, err := openStorage(ctx, cfg)
+	if err != nil {
+		log.Fatalf("storage: %v", err)
 	}
+	defer store.close()
 
-	repo := postgres.NewOrderRepository(db.Pool)
 	memCache := cache.NewMemoryCache()
-	svc := service.NewOrderService(repo, memCache)
+	svc := service.NewOrderService(traced.NewOrderRepository(store.repo, cfg.Storage), memCache)
 
 	// warm cache
 	if n, err := svc.WarmCache(ctx, cfg.CacheWarmLimit); err != nil {
@@ -49,21 +71,103 @@ func main() {
 
 	// HTTP
 	handlers := httpin.NewHandlers(svc)
+	if store.stats != nil {
+		handlers.AddStatus("db_pool", store.stats)
+	}
+	handlers.AddStatus("cache", func() any {
+		hits, misses := memCache.Stats()
+		return map[string]any{"size": memCache.Len(ctx), "hits": hits, "misses": misses}
+	})
 	mux := httpin.NewMux(handlers, svc)
 	httpSrv := runtime.NewHTTPServer(cfg.HTTPAddr, mux)
 	httpSrv.Start()
+	var adminSrv *runtime.HTTPServer
+	if cfg.AdminToken != "" {
+		adminSrv = runtime.NewHTTPServer(cfg.AdminHTTPAddr, httpin.NewAdminMux(handlers, cfg.AdminToken))
+		adminSrv.Start()
+	} else {
+		log.Printf("[http] ADMIN_TOKEN not set: admin endpoints disabled")
+	}
 
 	// kafka consumer
-	consumer := kafkain.NewConsumer(kafkain.ConsumerConfig{
-		Brokers:  cfg.KafkaBrokers,
-		Topic:    cfg.KafkaTopic,
-		GroupID:  cfg.KafkaConsumerGroup,
-		MinBytes: cfg.KafkaMinBytes,
-		MaxBytes: cfg.KafkaMaxBytes,
+	conn, err := kafkaConn(cfg)
+	if err != nil {
+		log.Fatalf("kafka: %v", err)
+	}
+	decoder, err := kafkain.NewDecoder(cfg.KafkaDecodeMode)
+	if err != nil {
+		log.Fatalf("kafka: %v", err)
+	}
+	decoder.AllowEvents(cfg.CloudEventsTypes, cfg.CloudEventsSources)
+	if cfg.AvroSchemaDir != "" {
+		reg, err := kafkain.LoadAvroRegistry(cfg.AvroSchemaDir)
+		if err != nil {
+			log.Fatalf("kafka: %v", err)
+		}
+		decoder.RegisterFormat(kafkain.NewAvroFormat(reg), kafkain.ContentTypesAvro...)
+		log.Printf("[kafka] decoding avro with %d schema(s) from %s", reg.Len(), cfg.AvroSchemaDir)
+	}
+	consumer, err := kafkain.NewConsumer(ctx, kafkain.ConsumerConfig{
+		Brokers:      cfg.KafkaBrokers,
+		Conn:         conn,
+		Topics:       cfg.KafkaTopics,
+		TopicPattern: cfg.KafkaTopicPattern,
+		GroupID:      cfg.KafkaConsumerGroup,
+		MinBytes:     cfg.KafkaMinBytes,
+		MaxBytes:     cfg.KafkaMaxBytes,
+		Decoder:      decoder,
+
+		DeadLetterTopic: cfg.KafkaDLQTopic,
+		Retry: kafkain.RetryPolicy{
+			MaxAttempts:    cfg.KafkaRetryMaxAttempts,
+			InitialBackoff: cfg.KafkaRetryInitialBackoff,
+			MaxBackoff:     cfg.KafkaRetryMaxBackoff,
+			Jitter:         cfg.KafkaRetryJitter,
+		},
+		Workers:      cfg.KafkaWorkers,
+		BatchSize:    cfg.KafkaBatchSize,
+		BatchTimeout: cfg.KafkaBatchTimeout,
 	}, svc)
+	if err != nil {
+		log.Fatalf("kafka: %v", err)
+	}
 	defer func() { _ = consumer.Close() }()
+	go consumer.RefreshStatus(ctx, cfg.KafkaStatusInterval)
+	handlers.AddStatus("kafka", func() any { return consumer.Status() })
+	handlers.SetIngestionControl(consumer)
+
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		consumer.Run(ctx)
+	}()
+
+	replayer := kafkain.NewReplayer(cfg.KafkaBrokers, conn, consumer.Topics(), decoder, svc)
+	defer replayer.Close()
+	handlers.SetReplayer(replayer)
+
+	// processed-message ledger
+	if cfg.LedgerRetention > 0 {
+		pruner := service.NewPruner("ledger", store.ledger.PruneLedger, cfg.LedgerRetention, cfg.LedgerPruneInterval)
+		handlers.AddStatus("ledger", func() any { return pruner.Stats() })
+		go pruner.Run(ctx)
+	}
+
+	// order events
+	if cfg.OrderEventsTopic != "" {
+		pub := kafkaout.NewEventPublisher(cfg.KafkaBrokers, conn, cfg.OrderEventsTopic, cfg.CloudEventsSource)
+		defer func() { _ = pub.Close() }()
 
-	go consumer.Run(ctx)
+		relay := service.NewOutboxRelay(store.outbox, pub, cfg.OutboxPollInterval, cfg.OutboxBatchSize)
+		handlers.AddStatus("outbox", func() any { return relay.Stats() })
+		go relay.Run(ctx)
+		if cfg.OutboxRetention > 0 {
+			pruner := service.NewPruner("outbox", store.outbox.PruneOutbox, cfg.OutboxRetention, cfg.OutboxPruneInterval)
+			handlers.AddStatus("outbox_prune", func() any { return pruner.Stats() })
+			go pruner.Run(ctx)
+		}
+		log.Printf("[outbox] publishing order events to %s", cfg.OrderEventsTopic)
+	}
 
 	<-ctx.Done()
 	log.Printf("[shutdown] signal received")
@@ -71,5 +175,132 @@ func main() {
 	if err := httpSrv.Shutdown(context.Background(), cfg.ShutdownTimeout); err != nil {
 		log.Printf("[shutdown] http: %v", err)
 	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(context.Background(), cfg.ShutdownTimeout); err != nil {
+			log.Printf("[shutdown] admin http: %v", err)
+		}
+	}
+
+	// let the consumer drain, so the offsets of messages that finished
+	// during shutdown are committed before the reader closes
+	select {
+	case <-consumerDone:
+	case <-time.After(cfg.ShutdownTimeout):
+		log.Printf("[shutdown] kafka consumer did not stop within %s", cfg.ShutdownTimeout)
+	}
 	log.Printf("[shutdown] bye")
 }
+
+// storage bundles the selected repository with its lifecycle hooks.
+// stats is nil for backends without a connection pool.
+type storage struct {
+	repo   outbound.OrderRepository
+	outbox outbound.OutboxStore
+	ledger outbound.LedgerStore
+	stats  func() any
+	close  func()
+}
+
+// openStorage builds the order repository selected by cfg.Storage and runs
+// the backend's migrations.
+func openStorage(ctx context.Context, cfg config.Config) (storage, error) {
+	switch cfg.Storage {
+	case config.StorageMemory:
+		log.Printf("[storage] using in-memory repository, data is lost on restart")
+		repo := memory.NewOrderRepository()
+		if cfg.OrderEventsTopic != "" {
+			repo.EnableOutbox()
+		}
+		return storage{repo: repo, outbox: repo, ledger: repo, close: func() {}}, nil
+
+	case config.StorageSQLite:
+		db, err := sqlite.New(ctx, cfg.SQLitePath)
+		if err != nil {
+			return storage{}, fmt.Errorf("sqlite init: %w", err)
+		}
+		migCtx, cancel := context.WithTimeout(ctx, cfg.MigrationsTimeout)
+		defer cancel()
+		if err := sqlite.RunMigrations(migCtx, db.SQL, migrationsFS(cfg.SQLiteMigrationsDir, migrations.SQLiteFS())); err != nil {
+			db.Close()
+			return storage{}, fmt.Errorf("migrations: %w", err)
+		}
+		log.Printf("[storage] using sqlite at %s", cfg.SQLitePath)
+		repo := sqlite.NewOrderRepository(db.SQL)
+		if cfg.OrderEventsTopic != "" {
+			repo.EnableOutbox()
+		}
+		return storage{
+			repo:   repo,
+			outbox: repo,
+			ledger: repo,
+			stats:  func() any { return db.Stats() },
+			close:  db.Close,
+		}, nil
+
+	case config.StoragePostgres:
+		db, err := postgres.New(ctx, cfg.DatabaseURL, poolConfig(cfg))
+		if err != nil {
+			return storage{}, fmt.Errorf("db init: %w", err)
+		}
+		opts := postgres.MigrateOptions{
+			OnDrift:     postgres.DriftPolicy(cfg.MigrationsOnDrift),
+			LockTimeout: cfg.MigrationsLockTimeout,
+			Timeout:     cfg.MigrationsTimeout,
+		}
+		if err := postgres.RunMigrations(ctx, db.Pool, migrationsFS(cfg.MigrationsDir, migrations.FS()), opts); err != nil {
+			db.Close()
+			return storage{}, fmt.Errorf("migrations: %w", err)
+		}
+		repo := postgres.NewOrderRepository(db.Pool)
+		if cfg.OrderEventsTopic != "" {
+			repo.EnableOutbox()
+		}
+		return storage{
+			repo:   repo,
+			outbox: repo,
+			ledger: repo,
+			stats:  func() any { return db.Stats() },
+			close:  db.Close,
+		}, nil
+	}
+
+	return storage{}, fmt.Errorf("unknown storage %q", cfg.Storage)
+}
+
+func poolConfig(cfg config.Config) postgres.PoolConfig {
+	return postgres.PoolConfig{
+		MaxConns:          int32(cfg.DBMaxConns),
+		MinConns:          int32(cfg.DBMinConns),
+		MaxConnLifetime:   cfg.DBMaxConnLifetime,
+		MaxConnIdleTime:   cfg.DBMaxConnIdleTime,
+		HealthCheckPeriod: cfg.DBHealthCheckPeriod,
+		ConnectTimeout:    cfg.DBConnectTimeout,
+		PingTimeout:       cfg.DBPingTimeout,
+		StatementTimeout:  cfg.DBStatementTimeout,
+		ApplicationName:   cfg.DBApplicationName,
+	}
+}
+
+// kafkaConn builds the TLS/SASL settings shared by every Kafka connection;
+// nil means plaintext.
+func kafkaConn(cfg config.Config) (*kafkaconn.Conn, error) {
+	return kafkaconn.New(kafkaconn.Config{
+		TLS:                cfg.KafkaTLSEnabled,
+		CAFile:             cfg.KafkaTLSCAFile,
+		CertFile:           cfg.KafkaTLSCertFile,
+		KeyFile:            cfg.KafkaTLSKeyFile,
+		InsecureSkipVerify: cfg.KafkaTLSInsecureSkipVerify,
+		SASLMechanism:      cfg.KafkaSASLMechanism,
+		Username:           cfg.KafkaSASLUsername,
+		Password:           cfg.KafkaSASLPassword,
+	})
+}
+
+// migrationsFS prefers an on-disk override and falls back to the embedded set.
+func migrationsFS(dir string, embedded fs.FS) fs.FS {
+	if dir == "" {
+		return embedded
+	}
+	log.Printf("[migrations] using directory %s instead of embedded files", dir)
+	return os.DirFS(dir)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"demo_service/internal/adapters/outbound/postgres"
+	"demo_service/internal/app/config"
+	"demo_service/internal/migrations"
+)
+
+const migrateUsage = `usage: app migrate [-timeout 30s] <command>
+
+commands:
+  status                         list applied and pending migrations
+  up [N]                         apply all, or the next N, pending migrations
+  down [N]                       revert the last N applied migrations (default 1)
+  goto V                         migrate up or down to version V
+  dry-run [up [N]|down [N]|goto V]
+                                 print the SQL the command would run (default: up)
+  create NAME                    scaffold the next NNNN_name.up.sql/.down.sql pair
+                                 in MIGRATIONS_DIR (default internal/migrations)
+  resolve V applied|pending      clear the dirty flag left by a failed
+                                 no-transaction migration once the schema is fixed
+`
+
+// runMigrate implements the migrate subcommand on top of the same runner
+// the service uses at startup.
+func runMigrate(ctx context.Context, args []string) error {
+	cfg, err := config.LoadDatabase()
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	fset := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fset.Usage = func() { fmt.Fprint(fset.Output(), migrateUsage) }
+	timeout := fset.Duration("timeout", cfg.MigrationsTimeout, "overall timeout, except for no-transaction migrations (env MIGRATIONS_TIMEOUT)")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	args = fset.Args()
+	if len(args) == 0 {
+		fset.Usage()
+		return errors.New("missing command")
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New("usage: migrate create NAME")
+		}
+		dir := cfg.MigrationsDir
+		if dir == "" {
+			dir = "internal/migrations"
+		}
+		up, down, err := postgres.CreateMigration(dir, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s\ncreated %s\n", up, down)
+		return nil
+	}
+
+	// migrations get the timeout through opts, which exempts
+	// no-transaction steps; everything else is bounded here
+	bounded, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	db, err := postgres.New(bounded, cfg.DatabaseURL, poolConfig(cfg))
+	if err != nil {
+		return fmt.Errorf("db init: %w", err)
+	}
+	defer db.Close()
+
+	fsys := migrationsFS(cfg.MigrationsDir, migrations.FS())
+	opts := postgres.MigrateOptions{
+		OnDrift:     postgres.DriftPolicy(cfg.MigrationsOnDrift),
+		LockTimeout: cfg.MigrationsLockTimeout,
+		Timeout:     *timeout,
+	}
+
+	cmd, rest := args[0], args[1:]
+	if cmd == "dry-run" {
+		opts.DryRun = os.Stdout
+		cmd, rest = "up", nil
+		if len(args) > 1 {
+			cmd, rest = args[1], args[2:]
+		}
+	}
+
+	switch cmd {
+	case "status":
+		st, err := postgres.Status(bounded, db.Pool, fsys)
+		if err != nil {
+			return err
+		}
+		return printStatus(os.Stdout, st)
+
+	case "up":
+		n, err := optionalInt(rest)
+		if err != nil {
+			return err
+		}
+		return postgres.MigrateUp(ctx, db.Pool, fsys, opts, n)
+
+	case "down":
+		n, err := optionalInt(rest)
+		if err != nil {
+			return err
+		}
+		return postgres.MigrateDown(ctx, db.Pool, fsys, opts, n)
+
+	case "goto":
+		if len(rest) != 1 {
+			return errors.New("usage: migrate goto V")
+		}
+		v, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", rest[0])
+		}
+		return postgres.MigrateTo(ctx, db.Pool, fsys, opts, v)
+
+	case "resolve":
+		if len(rest) != 2 || (rest[1] != "applied" && rest[1] != "pending") {
+			return errors.New("usage: migrate resolve V applied|pending")
+		}
+		v, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", rest[0])
+		}
+		return postgres.Resolve(bounded, db.Pool, v, rest[1] == "applied")
+	}
+
+	fset.Usage()
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+// printStatus writes st as a table, followed by the errors of dirty
+// migrations; those are listed below it so they do not widen its columns.
+func printStatus(w io.Writer, st []postgres.MigrationStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	var errs []string
+	for _, s := range st {
+		at := "-"
+		if !s.AppliedAt.IsZero() {
+			at = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Version, s.Name, s.State, at)
+		if s.Error != "" {
+			errs = append(errs, fmt.Sprintf("v=%d (%s): %s", s.Version, s.Name, s.Error))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		if _, err := fmt.Fprintf(w, "\nerrors:\n  %s\n", strings.Join(errs, "\n  ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func optionalInt(args []string) (int, error) {
+	switch len(args) {
+	case 0:
+		return 0, nil
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid count %q", args[0])
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("unexpected arguments: %v", args[1:])
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"demo_service/internal/adapters/outbound/postgres"
+)
+
+func TestOptionalInt(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    int
+		wantErr string
+	}{
+		{nil, 0, ""},
+		{[]string{"3"}, 3, ""},
+		{[]string{"0"}, 0, ""},
+		{[]string{"-1"}, 0, `invalid count "-1"`},
+		{[]string{"two"}, 0, `invalid count "two"`},
+		{[]string{"1", "2"}, 0, "unexpected arguments: [2]"},
+	}
+	for _, tt := range tests {
+		n, err := optionalInt(tt.args)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("optionalInt(%q) err = %v, want %q", tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || n != tt.want {
+			t.Errorf("optionalInt(%q) = %d, %v, want %d", tt.args, n, err, tt.want)
+		}
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)
+	var buf bytes.Buffer
+	err := printStatus(&buf, []postgres.MigrationStatus{
+		{Version: 1, Name: "0001_init.up.sql", AppliedAt: at, State: postgres.StateApplied},
+		{Version: 2, Name: "0002_index.up.sql", AppliedAt: at, State: postgres.StateDirty, Error: "statement 1/1: boom"},
+		{Version: 3, Name: "0003_next.up.sql", State: postgres.StatePending},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"VERSION  NAME               STATE    APPLIED AT",
+		"1        0001_init.up.sql   applied  2024-05-01 12:30:00",
+		"2        0002_index.up.sql  dirty    2024-05-01 12:30:00",
+		"3        0003_next.up.sql   pending  -",
+		"",
+		"errors:",
+		"  v=2 (0002_index.up.sql): statement 1/1: boom",
+	}
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("status output:\n%s", buf.String())
+	}
+	for i := range want {
+		if strings.TrimRight(got[i], " ") != want[i] {
+			t.Errorf("line %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
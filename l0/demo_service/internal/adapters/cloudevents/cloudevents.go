@@ -0,0 +1,27 @@
+// Package cloudevents names the message headers of the CloudEvents Kafka
+// protocol binding, shared by the consumer that reads events and the
+// publisher that writes them.
+package cloudevents
+
+// Binary mode carries the event attributes as ce_* headers and the data
+// as the message value, its type in the content-type header.
+const (
+	HeaderSpecVersion = "ce_specversion"
+	HeaderID          = "ce_id"
+	HeaderSource      = "ce_source"
+	HeaderType        = "ce_type"
+	HeaderTime        = "ce_time"
+	HeaderSubject     = "ce_subject"
+	// HeaderTraceparent is the distributed tracing extension, a W3C
+	// traceparent.
+	HeaderTraceparent = "ce_traceparent"
+
+	HeaderContentType = "content-type"
+)
+
+// SpecVersion is the only CloudEvents version produced and accepted.
+const SpecVersion = "1.0"
+
+// ContentTypeStructured marks a structured-mode event: the whole event is
+// the JSON message value.
+const ContentTypeStructured = "application/cloudevents+json"
@@ -0,0 +1,54 @@
+package httpin
+
+import (
+	"net/http"
+
+	"demo_service/internal/ports/inbound"
+)
+
+// SetIngestionControl enables /admin/consumer. Until it is called the
+// endpoints answer 503.
+func (h *Handlers) SetIngestionControl(ic inbound.IngestionControl) {
+	h.statusMu.Lock()
+	h.ingestion = ic
+	h.statusMu.Unlock()
+}
+
+type consumerState struct {
+	Paused bool `json:"paused"`
+}
+
+// consumerControl serves GET /admin/consumer and POST
+// /admin/consumer/pause|resume.
+func (h *Handlers) consumerControl(w http.ResponseWriter, r *http.Request) {
+	h.statusMu.RLock()
+	ic := h.ingestion
+	h.statusMu.RUnlock()
+	if ic == nil {
+		http.Error(w, "consumer control not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/admin/consumer":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	case "/admin/consumer/pause", "/admin/consumer/resume":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path == "/admin/consumer/pause" {
+			ic.PauseIngestion()
+		} else {
+			ic.ResumeIngestion()
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, consumerState{Paused: ic.IngestionPaused()}, http.StatusOK)
+}
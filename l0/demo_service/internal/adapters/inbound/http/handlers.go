@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
 	"demo_service/internal/core/domain"
 	"demo_service/internal/ports/inbound"
@@ -16,6 +17,11 @@ import (
 type Handlers struct {
 	uc        inbound.OrderUseCase
 	adminTmpl *template.Template
+
+	statusMu  sync.RWMutex
+	statuses  map[string]func() any
+	replayer  inbound.Replayer
+	ingestion inbound.IngestionControl
 }
 
 func NewHandlers(uc inbound.OrderUseCase) *Handlers {
@@ -23,13 +29,30 @@ func NewHandlers(uc inbound.OrderUseCase) *Handlers {
 	return &Handlers{
 		uc:        uc,
 		adminTmpl: t,
+		statuses:  make(map[string]func() any),
 	}
 }
 
+// AddStatus registers a snapshot function whose result is reported under
+// name by /status. Registering the same name again replaces the previous one.
+func (h *Handlers) AddStatus(name string, fn func() any) {
+	h.statusMu.Lock()
+	h.statuses[name] = fn
+	h.statusMu.Unlock()
+}
+
 func (h *Handlers) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/health", h.health)
 	mux.HandleFunc("/order/", h.getOrderByID)
 	mux.HandleFunc("/admin", h.admin)
+	mux.HandleFunc("/status", h.status)
+}
+
+// RegisterAdmin adds the endpoints served by NewAdminMux.
+func (h *Handlers) RegisterAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/replay", h.replay)
+	mux.HandleFunc("/admin/consumer", h.consumerControl)
+	mux.HandleFunc("/admin/consumer/", h.consumerControl)
 }
 
 func (h *Handlers) health(w http.ResponseWriter, _ *http.Request) {
@@ -60,7 +83,34 @@ func (h *Handlers) getOrderByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, order, http.StatusOK)
+	writeJSON(w, newOrderResponse(order), http.StatusOK)
+}
+
+// orderResponse is an order as the HTTP API returns it: its JSON plus the
+// topic it was read from, which domain.Order leaves out.
+type orderResponse struct {
+	domain.Order
+	SourceTopic string `json:"source_topic,omitempty"`
+}
+
+func newOrderResponse(o domain.Order) orderResponse {
+	return orderResponse{Order: o, SourceTopic: o.SourceTopic}
+}
+
+func (h *Handlers) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.statusMu.RLock()
+	out := make(map[string]any, len(h.statuses))
+	for name, fn := range h.statuses {
+		out[name] = fn()
+	}
+	h.statusMu.RUnlock()
+
+	writeJSON(w, out, http.StatusOK)
 }
 
 func writeJSON(w http.ResponseWriter, v any, status int) {
@@ -0,0 +1,140 @@
+package httpin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"demo_service/internal/ports/inbound"
+)
+
+// SetReplayer enables /admin/replay. Until it is called the endpoint
+// answers 503.
+func (h *Handlers) SetReplayer(r inbound.Replayer) {
+	h.statusMu.Lock()
+	h.replayer = r
+	h.statusMu.Unlock()
+}
+
+// replay serves /admin/replay:
+//
+//	GET     progress of the current or last replay
+//	POST    start one from a JSON body: topic, partition (default all),
+//	        from_offset or from_time (RFC 3339), rate (messages/s,
+//	        default unlimited)
+//	DELETE  cancel the running replay
+func (h *Handlers) replay(w http.ResponseWriter, r *http.Request) {
+	h.statusMu.RLock()
+	rp := h.replayer
+	h.statusMu.RUnlock()
+	if rp == nil {
+		http.Error(w, "replay not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, rp.ReplayStatus(), http.StatusOK)
+
+	case http.MethodPost:
+		req, err := parseReplayRequest(r)
+		if errors.Is(err, errUnsupportedMedia) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := rp.StartReplay(r.Context(), req); err != nil {
+			switch {
+			case errors.Is(err, inbound.ErrReplayRunning):
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			case errors.Is(err, inbound.ErrInvalidReplay):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "replay: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, rp.ReplayStatus(), http.StatusAccepted)
+
+	case http.MethodDelete:
+		if !rp.CancelReplay() {
+			http.Error(w, "no replay running", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, rp.ReplayStatus(), http.StatusOK)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// maxReplayBody bounds the POST body; a replay request is a few fields.
+const maxReplayBody = 4 << 10
+
+// replayBody is the JSON body of POST /admin/replay. Partition nil means
+// all partitions.
+type replayBody struct {
+	Topic      string     `json:"topic"`
+	Partition  *int       `json:"partition"`
+	FromOffset *int64     `json:"from_offset"`
+	FromTime   *time.Time `json:"from_time"`
+	Rate       float64    `json:"rate"`
+}
+
+// errUnsupportedMedia rejects anything but a JSON body, which a
+// cross-site form post cannot send.
+var errUnsupportedMedia = errors.New("Content-Type must be application/json")
+
+func parseReplayRequest(r *http.Request) (inbound.ReplayRequest, error) {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mt != "application/json" {
+		return inbound.ReplayRequest{}, errUnsupportedMedia
+	}
+
+	var body replayBody
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxReplayBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		return inbound.ReplayRequest{}, fmt.Errorf("invalid JSON body: %w", err)
+	}
+
+	req := inbound.ReplayRequest{
+		Topic:     strings.TrimSpace(body.Topic),
+		Partition: -1,
+		Rate:      body.Rate,
+	}
+	if body.Partition != nil {
+		if *body.Partition < 0 {
+			return req, errors.New("partition must be a non-negative integer or omitted for all")
+		}
+		req.Partition = *body.Partition
+	}
+
+	switch {
+	case body.FromOffset != nil && body.FromTime != nil:
+		return req, errors.New("use either from_offset or from_time")
+	case body.FromOffset != nil:
+		if *body.FromOffset < 0 {
+			return req, errors.New("from_offset must be a non-negative integer")
+		}
+		req.FromOffset = *body.FromOffset
+	case body.FromTime != nil:
+		req.FromTime = *body.FromTime
+	default:
+		return req, errors.New("from_offset or from_time is required")
+	}
+
+	if req.Rate < 0 {
+		return req, errors.New("rate must be a non-negative number")
+	}
+	return req, nil
+}
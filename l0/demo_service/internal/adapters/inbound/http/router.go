@@ -1,7 +1,9 @@
 package httpin
 
 import (
+	"crypto/subtle"
 	"net/http"
+	"strings"
 
 	"demo_service/internal/ports/inbound"
 )
@@ -17,3 +19,26 @@ func NewMux(h *Handlers, uc inbound.OrderUseCase) *http.ServeMux {
 
 	return mux
 }
+
+// NewAdminMux serves the endpoints that change what the service does, for
+// a listener separate from the public one. Every request must carry
+// "Authorization: Bearer <token>"; browsers do not attach that header to
+// cross-site requests, so a forged form post cannot reach them.
+func NewAdminMux(h *Handlers, token string) http.Handler {
+	mux := http.NewServeMux()
+	h.RegisterAdmin(mux)
+	return requireToken(token, mux)
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(strings.TrimSpace(r.Header.Get("Authorization")))
+		if token == "" || subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,192 @@
+package httpin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	httpin "demo_service/internal/adapters/inbound/http"
+	"demo_service/internal/core/domain"
+	"demo_service/internal/ports/inbound"
+)
+
+type replayer struct{ started []inbound.ReplayRequest }
+
+func (r *replayer) StartReplay(_ context.Context, req inbound.ReplayRequest) error {
+	r.started = append(r.started, req)
+	return nil
+}
+
+func (r *replayer) CancelReplay() bool { return false }
+
+func (r *replayer) ReplayStatus() inbound.ReplayStatus { return inbound.ReplayStatus{} }
+
+func TestAdminReplay(t *testing.T) {
+	rp := &replayer{}
+	h := httpin.NewHandlers(nil)
+	h.SetReplayer(rp)
+	admin := httpin.NewAdminMux(h, "secret")
+
+	tests := []struct {
+		name        string
+		auth        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"no token", "", "application/json", `{"from_offset": 0}`, http.StatusUnauthorized},
+		{"wrong token", "Bearer nope", "application/json", `{"from_offset": 0}`, http.StatusUnauthorized},
+		{"form post", "Bearer secret", "application/x-www-form-urlencoded", "from_offset=0", http.StatusUnsupportedMediaType},
+		{"unknown field", "Bearer secret", "application/json", `{"from_offset": 0, "partitions": 2}`, http.StatusBadRequest},
+		{"both starts", "Bearer secret", "application/json", `{"from_offset": 0, "from_time": "2024-05-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"ok", "Bearer secret", "application/json; charset=utf-8", `{"partition": 2, "from_offset": 1500, "rate": 200}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/replay", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			admin.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	if len(rp.started) != 1 {
+		t.Fatalf("%d replays started, want 1", len(rp.started))
+	}
+	if got := rp.started[0]; got.Partition != 2 || got.FromOffset != 1500 || got.Rate != 200 {
+		t.Errorf("started %+v", got)
+	}
+}
+
+func TestPublicMuxHasNoReplay(t *testing.T) {
+	h := httpin.NewHandlers(nil)
+	h.SetReplayer(&replayer{})
+	mux := httpin.NewMux(h, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/replay", strings.NewReader(`{"from_offset": 0}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code == http.StatusAccepted {
+		t.Fatal("the public mux started a replay")
+	}
+}
+
+type ingestion struct{ paused bool }
+
+func (i *ingestion) PauseIngestion()       { i.paused = true }
+func (i *ingestion) ResumeIngestion()      { i.paused = false }
+func (i *ingestion) IngestionPaused() bool { return i.paused }
+
+func TestAdminConsumerControl(t *testing.T) {
+	ic := &ingestion{}
+	h := httpin.NewHandlers(nil)
+	h.SetIngestionControl(ic)
+
+	pause := func(handler http.Handler, auth string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/consumer/pause", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := pause(httpin.NewMux(h, nil), ""); code == http.StatusOK || ic.paused {
+		t.Fatalf("the public mux paused ingestion (status %d)", code)
+	}
+	admin := httpin.NewAdminMux(h, "secret")
+	if code := pause(admin, ""); code != http.StatusUnauthorized || ic.paused {
+		t.Fatalf("status %d without a token, want %d", code, http.StatusUnauthorized)
+	}
+	if code := pause(admin, "Bearer secret"); code != http.StatusOK || !ic.paused {
+		t.Fatalf("status %d with the token, want %d and ingestion paused", code, http.StatusOK)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	h := httpin.NewHandlers(nil)
+	h.AddStatus("db_pool", func() any { return map[string]int{"max_conns": 10} })
+	h.AddStatus("cache", func() any { return map[string]int{"size": 1} })
+	h.AddStatus("cache", func() any { return map[string]int{"size": 2} })
+	mux := httpin.NewMux(h, nil)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("content type %q", ct)
+	}
+	var got map[string]map[string]int
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if len(got) != 2 || got["db_pool"]["max_conns"] != 10 || got["cache"]["size"] != 2 {
+		t.Errorf("sections %v, want db_pool and the replaced cache", got)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /status: status %d", rec.Code)
+	}
+}
+
+// orderLookup serves one order; the other use case methods are not used.
+type orderLookup struct {
+	inbound.OrderUseCase
+	order domain.Order
+}
+
+func (u orderLookup) GetByID(_ context.Context, id string) (domain.Order, error) {
+	if id != u.order.OrderUID {
+		return domain.Order{}, domain.ErrNotFound
+	}
+	return u.order, nil
+}
+
+func TestGetOrderIncludesSourceTopic(t *testing.T) {
+	uc := orderLookup{order: domain.Order{OrderUID: "o-1", TrackNumber: "T1", SourceTopic: "orders-eu"}}
+	mux := httpin.NewMux(httpin.NewHandlers(uc), uc)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order/o-1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if got["order_uid"] != "o-1" || got["track_number"] != "T1" || got["source_topic"] != "orders-eu" {
+		t.Errorf("response %v, want the order with its source_topic", got)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order/o-2", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown order: status %d", rec.Code)
+	}
+}
+
+func TestOrderJSONOmitsSourceTopic(t *testing.T) {
+	b, err := json.Marshal(domain.Order{OrderUID: "o-1", SourceTopic: "orders-eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "source_topic") || strings.Contains(string(b), "orders-eu") {
+		t.Errorf("domain.Order JSON carries the source topic: %s", b)
+	}
+}
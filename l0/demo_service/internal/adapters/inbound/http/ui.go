@@ -57,7 +57,7 @@ func (u *UI) FetchOrderSSE(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b, _ := json.MarshalIndent(order, "", "  ")
+	b, _ := json.MarshalIndent(newOrderResponse(order), "", "  ")
 	sse.PatchElements(`<p id="status">OK</p>`)
 	sse.PatchElements(`<pre id="result">` + htmlEscape(string(b)) + `</pre>`)
 }
@@ -0,0 +1,94 @@
+package kafkain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hamba/avro/v2"
+	"github.com/segmentio/kafka-go"
+)
+
+// ContentTypesAvro are the content types decoded by the format returned
+// from NewAvroFormat.
+var ContentTypesAvro = []string{"application/avro", "avro/binary", "application/vnd.apache.avro+binary"}
+
+// AvroRegistry is a local stand-in for a schema registry: the schema with
+// id N is the file N.avsc in one directory.
+type AvroRegistry struct {
+	schemas map[int]avro.Schema
+}
+
+// LoadAvroRegistry parses every <id>.avsc file in dir.
+func LoadAvroRegistry(dir string) (*AvroRegistry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.avsc"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &AvroRegistry{schemas: make(map[int]avro.Schema, len(files))}
+	for _, f := range files {
+		id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(f), ".avsc"))
+		if err != nil {
+			return nil, fmt.Errorf("avro schema %s: file name is not a schema id", f)
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read avro schema: %w", err)
+		}
+		s, err := avro.Parse(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("parse avro schema %s: %w", f, err)
+		}
+		r.schemas[id] = s
+	}
+	if len(r.schemas) == 0 {
+		return nil, fmt.Errorf("no avro schemas (*.avsc) in %s", dir)
+	}
+	return r, nil
+}
+
+func (r *AvroRegistry) Len() int { return len(r.schemas) }
+
+// avroFormat decodes values in the schema registry wire format: a zero
+// magic byte, the big-endian 4-byte schema id, then the Avro datum. The
+// record's field names are those of the JSON order, so the result is
+// decoded like a bare JSON order, including its schema-version header.
+type avroFormat struct {
+	reg *AvroRegistry
+}
+
+func NewAvroFormat(reg *AvroRegistry) Format {
+	return avroFormat{reg: reg}
+}
+
+func (f avroFormat) Payload(msg kafka.Message, _ bool) (Payload, error) {
+	if len(msg.Value) < 5 || msg.Value[0] != 0 {
+		return Payload{}, errors.New("avro decode: value is not in schema registry wire format")
+	}
+	id := int(binary.BigEndian.Uint32(msg.Value[1:5]))
+	s, ok := f.reg.schemas[id]
+	if !ok {
+		return Payload{}, fmt.Errorf("avro decode: unknown schema id %d", id)
+	}
+
+	var doc any
+	if err := avro.Unmarshal(s, msg.Value[5:], &doc); err != nil {
+		return Payload{}, fmt.Errorf("avro decode (schema %d): %w", id, err)
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return Payload{}, fmt.Errorf("avro decode (schema %d): %w", id, err)
+	}
+
+	version, err := headerVersion(msg)
+	if err != nil {
+		return Payload{}, err
+	}
+	return Payload{JSON: b, Version: version}, nil
+}
@@ -0,0 +1,82 @@
+package kafkain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+// avroSchemaDir holds the schemas the service is run with in development.
+const avroSchemaDir = "../../../../scripts/avro"
+
+// avroNative converts the generic JSON doc to the Go types hamba/avro
+// encodes for the schema: longs as int64 and timestamp-millis as
+// time.Time.
+func avroNative(t *testing.T, v any, field string) any {
+	t.Helper()
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, x := range v {
+			out[k] = avroNative(t, x, k)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, x := range v {
+			out[i] = avroNative(t, x, field)
+		}
+		return out
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			t.Fatalf("%s: %v", field, err)
+		}
+		return n
+	case string:
+		if field == "date_created" {
+			ts, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				t.Fatalf("%s: %v", field, err)
+			}
+			return ts
+		}
+		return v
+	}
+	return v
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	b, err := os.ReadFile(avroSchemaDir + "/1.avsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := avro.Parse(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := avroNative(t, sampleOrder(t), "").(map[string]any)
+	// a nullable union is written with the branch named
+	doc["internal_signature"] = map[string]any{"string": doc["internal_signature"]}
+	datum, err := avro.Marshal(schema, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := binary.BigEndian.AppendUint32([]byte{0}, 1)
+	value = append(value, datum...)
+
+	reg, err := LoadAvroRegistry(avroSchemaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDecoder(DecodeStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.RegisterFormat(NewAvroFormat(reg), ContentTypesAvro...)
+	assertSameOrder(t, d, ContentTypesAvro[0], value)
+}
@@ -0,0 +1,155 @@
+package kafkain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"demo_service/internal/adapters/cloudevents"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// CloudEvents Kafka protocol binding: in binary mode the attributes are
+// ce_* headers and the value is the data; in structured mode the value is
+// a JSON event with content type ContentTypeCloudEvents.
+const (
+	HeaderCESpecVersion = cloudevents.HeaderSpecVersion
+	HeaderCEID          = cloudevents.HeaderID
+	HeaderCESource      = cloudevents.HeaderSource
+	HeaderCEType        = cloudevents.HeaderType
+	HeaderCETime        = cloudevents.HeaderTime
+	HeaderCESubject     = cloudevents.HeaderSubject
+
+	ContentTypeCloudEvents = cloudevents.ContentTypeStructured
+)
+
+// CloudEvent holds the attributes of an order delivered as a CloudEvent.
+type CloudEvent struct {
+	ID      string
+	Source  string
+	Type    string
+	Subject string
+	Time    time.Time
+}
+
+// structuredEvent is the JSON form of a structured-mode event.
+type structuredEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            string          `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+	DataBase64      string          `json:"data_base64"`
+}
+
+// AllowEvents restricts the CloudEvents the decoder accepts to the given
+// types and sources; an empty list allows any. Messages that are not
+// CloudEvents are unaffected. It must not be called while messages are
+// being decoded.
+func (d *Decoder) AllowEvents(types, sources []string) {
+	d.eventTypes = types
+	d.eventSources = sources
+}
+
+// cloudEvent recognizes a CloudEvent in either mode and returns its
+// attributes and a message carrying just the data with its content type.
+// Messages that are not CloudEvents come back unchanged with a nil event.
+func (d *Decoder) cloudEvent(msg kafka.Message) (*CloudEvent, kafka.Message, error) {
+	if mediaType(contentType(msg.Headers)) == ContentTypeCloudEvents {
+		return d.structured(msg)
+	}
+	if headerValue(msg.Headers, HeaderCESpecVersion) == "" {
+		return nil, msg, nil
+	}
+
+	ev := &CloudEvent{
+		ID:      headerValue(msg.Headers, HeaderCEID),
+		Source:  headerValue(msg.Headers, HeaderCESource),
+		Type:    headerValue(msg.Headers, HeaderCEType),
+		Subject: headerValue(msg.Headers, HeaderCESubject),
+	}
+	err := d.validateEvent(ev, headerValue(msg.Headers, HeaderCESpecVersion), headerValue(msg.Headers, HeaderCETime))
+	if err != nil {
+		return nil, msg, err
+	}
+	return ev, msg, nil
+}
+
+func (d *Decoder) structured(msg kafka.Message) (*CloudEvent, kafka.Message, error) {
+	var se structuredEvent
+	if err := json.Unmarshal(msg.Value, &se); err != nil {
+		return nil, msg, fmt.Errorf("cloudevent decode: %w", err)
+	}
+	ev := &CloudEvent{ID: se.ID, Source: se.Source, Type: se.Type, Subject: se.Subject}
+	if err := d.validateEvent(ev, se.SpecVersion, se.Time); err != nil {
+		return nil, msg, err
+	}
+
+	var data []byte
+	switch {
+	case se.DataBase64 != "":
+		b, err := base64.StdEncoding.DecodeString(se.DataBase64)
+		if err != nil {
+			return nil, msg, fmt.Errorf("cloudevent data_base64: %w", err)
+		}
+		data = b
+	case len(se.Data) > 0:
+		data = se.Data
+	default:
+		return nil, msg, errors.New("cloudevent has no data")
+	}
+
+	ct := se.DataContentType
+	if ct == "" {
+		ct = ContentTypeJSON
+	}
+	headers := make([]kafka.Header, 0, len(msg.Headers)+1)
+	for _, h := range msg.Headers {
+		if !strings.EqualFold(h.Key, HeaderContentType) {
+			headers = append(headers, h)
+		}
+	}
+	headers = append(headers, kafka.Header{Key: HeaderContentType, Value: []byte(ct)})
+
+	inner := msg
+	inner.Value = data
+	inner.Headers = headers
+	return ev, inner, nil
+}
+
+func (d *Decoder) validateEvent(ev *CloudEvent, specVersion, ts string) error {
+	if specVersion != cloudevents.SpecVersion {
+		return fmt.Errorf("cloudevent: unsupported specversion %q", specVersion)
+	}
+	if ev.ID == "" || ev.Source == "" || ev.Type == "" {
+		return errors.New("cloudevent: id, source and type are required")
+	}
+	if len(d.eventTypes) > 0 && !slices.Contains(d.eventTypes, ev.Type) {
+		return fmt.Errorf("cloudevent: unexpected type %q", ev.Type)
+	}
+	if len(d.eventSources) > 0 && !slices.Contains(d.eventSources, ev.Source) {
+		return fmt.Errorf("cloudevent: unexpected source %q", ev.Source)
+	}
+	if ts != "" {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return fmt.Errorf("cloudevent: invalid time %q", ts)
+		}
+		ev.Time = t
+	}
+	return nil
+}
+
+// eventID returns the binary-mode event id of msg, for log lines about
+// messages that could not be decoded.
+func eventID(msg kafka.Message) string {
+	return headerValue(msg.Headers, HeaderCEID)
+}
@@ -0,0 +1,174 @@
+package kafkain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func binaryMessage(data []byte, headers ...kafka.Header) kafka.Message {
+	return kafka.Message{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Value:     data,
+		Headers: append([]kafka.Header{
+			{Key: HeaderCESpecVersion, Value: []byte("1.0")},
+			{Key: HeaderCEID, Value: []byte("evt-1")},
+			{Key: HeaderCESource, Value: []byte("/checkout")},
+			{Key: HeaderCEType, Value: []byte("com.example.order.created")},
+			{Key: HeaderCESubject, Value: []byte("b563feb7b2b84b6test")},
+			{Key: HeaderCETime, Value: []byte("2024-05-01T10:00:00.5Z")},
+		}, headers...),
+	}
+}
+
+func structuredMessage(t *testing.T, fields map[string]any) kafka.Message {
+	t.Helper()
+	ev := map[string]any{
+		"specversion": "1.0",
+		"id":          "evt-1",
+		"source":      "/checkout",
+		"type":        "com.example.order.created",
+		"subject":     "b563feb7b2b84b6test",
+		"time":        "2024-05-01T10:00:00.5Z",
+	}
+	for k, v := range fields {
+		ev[k] = v
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafka.Message{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Value:     b,
+		Headers:   []kafka.Header{{Key: "Content-Type", Value: []byte(ContentTypeCloudEvents + "; charset=utf-8")}},
+	}
+}
+
+func TestCloudEventModes(t *testing.T) {
+	data := sampleOrderJSON(t)
+	tests := []struct {
+		name string
+		msg  kafka.Message
+	}{
+		{"binary", binaryMessage(data)},
+		{"binary with content type", binaryMessage(data, kafka.Header{Key: HeaderContentType, Value: []byte("application/json")})},
+		{"structured", structuredMessage(t, map[string]any{"data": json.RawMessage(data)})},
+		{"structured base64", structuredMessage(t, map[string]any{
+			"datacontenttype": "application/json",
+			"data_base64":     base64.StdEncoding.EncodeToString(data),
+		})},
+	}
+
+	want := CloudEvent{
+		ID:      "evt-1",
+		Source:  "/checkout",
+		Type:    "com.example.order.created",
+		Subject: "b563feb7b2b84b6test",
+		Time:    time.Date(2024, 5, 1, 10, 0, 0, 5e8, time.UTC),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDecoder(DecodeStrict)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := d.Decode(tt.msg)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got.Event == nil {
+				t.Fatal("not recognized as a CloudEvent")
+			}
+			if ev := *got.Event; ev.ID != want.ID || ev.Source != want.Source || ev.Type != want.Type ||
+				ev.Subject != want.Subject || !ev.Time.Equal(want.Time) {
+				t.Errorf("event %+v, want %+v", ev, want)
+			}
+			if got.Order.OrderUID != "b563feb7b2b84b6test" || got.Order.SourceTopic != "orders" {
+				t.Errorf("order %q from %q", got.Order.OrderUID, got.Order.SourceTopic)
+			}
+		})
+	}
+}
+
+func TestCloudEventRejected(t *testing.T) {
+	data := sampleOrderJSON(t)
+	noID := binaryMessage(data)
+	for i, h := range noID.Headers {
+		if h.Key == HeaderCEID {
+			noID.Headers[i].Value = nil
+		}
+	}
+	tests := []struct {
+		name string
+		msg  kafka.Message
+		want string
+	}{
+		{"binary spec version", binaryMessage(data, kafka.Header{Key: HeaderCESpecVersion, Value: []byte("0.3")}), "specversion"},
+		{"binary without id", noID, "required"},
+		{"binary bad time", binaryMessage(data, kafka.Header{Key: HeaderCETime, Value: []byte("yesterday")}), "invalid time"},
+		{"binary type not allowed", binaryMessage(data, kafka.Header{Key: HeaderCEType, Value: []byte("com.example.order.deleted")}), "unexpected type"},
+		{"structured without data", structuredMessage(t, nil), "no data"},
+		{"structured source not allowed", structuredMessage(t, map[string]any{"source": "/elsewhere", "data": json.RawMessage(data)}), "unexpected source"},
+		{"structured bad base64", structuredMessage(t, map[string]any{"data_base64": "%%%"}), "data_base64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDecoder(DecodeStrict)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.AllowEvents([]string{"com.example.order.created"}, []string{"/checkout"})
+			_, err = d.Decode(tt.msg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestMessageRefLedgerKey checks that a CloudEvent is deduplicated by
+// source and id, whatever its offset, and a plain message by its offset.
+func TestMessageRefLedgerKey(t *testing.T) {
+	d, err := NewDecoder(DecodeStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := sampleOrderJSON(t)
+
+	first := binaryMessage(data)
+	republished := binaryMessage(data)
+	republished.Partition, republished.Offset = 0, 7
+	otherSource := binaryMessage(data, kafka.Header{Key: HeaderCESource, Value: []byte("/backfill")})
+
+	key := func(msg kafka.Message) string {
+		t.Helper()
+		dec, err := d.Decode(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return messageRef(msg, dec).LedgerKey()
+	}
+
+	if got, want := key(first), "id:/checkout evt-1"; got != want {
+		t.Errorf("ledger key %q, want %q", got, want)
+	}
+	if key(republished) != key(first) {
+		t.Error("a re-published event got a different ledger key")
+	}
+	if key(otherSource) == key(first) {
+		t.Error("the same event id from another source got the same ledger key")
+	}
+	plain := kafka.Message{Topic: "orders", Partition: 3, Offset: 42, Value: data}
+	if got, want := key(plain), "orders/3/42"; got != want {
+		t.Errorf("plain message ledger key %q, want %q", got, want)
+	}
+}
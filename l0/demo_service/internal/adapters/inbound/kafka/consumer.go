@@ -3,45 +3,269 @@ package kafkain
 import (
 	"context"
 	"errors"
+	"hash/fnv"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"demo_service/internal/core/service"
+	"demo_service/internal/adapters/kafkaconn"
+	"demo_service/internal/core/domain"
+	"demo_service/internal/core/trace"
+	"demo_service/internal/ports/inbound"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// MessageSource is where the consumer gets its messages: a consumer group
+// member with explicit commits. *kafka.Reader is the production source;
+// kafkatest.Source is an in-memory one.
+type MessageSource interface {
+	// FetchMessage blocks for the next message and returns ctx's error
+	// once ctx is done.
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	// CommitMessages marks msgs, and everything before them on their
+	// partitions, as processed.
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// DeadLetterPublisher takes messages the consumer gives up on.
+// *DeadLetterQueue publishes them to a topic.
+type DeadLetterPublisher interface {
+	Publish(ctx context.Context, msg kafka.Message, class string, cause error) error
+	Topic() string
+	Close() error
+}
+
 type Consumer struct {
-	reader *kafka.Reader
-	svc    *service.OrderService
+	source  MessageSource
+	client  *kafka.Client // nil without brokers: no lag on the status page
+	topics  []string
+	group   string
+	dlq     DeadLetterPublisher
+	decoder *Decoder
+	retry   RetryPolicy
+	workers int
+	batch   int
+	wait    time.Duration
+	uc      inbound.OrderUseCase
+
+	perTopic map[string]*topicCounters
+
+	pauseMu sync.Mutex
+	resumed chan struct{} // non-nil while paused; closed on resume
+
+	statusMu sync.Mutex
+	broker   brokerStatus
+}
+
+// ConsumerStats are counters since the consumer was created.
+type ConsumerStats struct {
+	Processed    uint64 `json:"processed"`
+	Duplicates   uint64 `json:"duplicates"`
+	DeadLettered uint64 `json:"dead_lettered"`
+	// UnknownFields counts messages accepted in lenient mode despite
+	// fields their schema does not know.
+	UnknownFields uint64 `json:"unknown_fields"`
+}
+
+// Stats returns the counters summed over all topics.
+func (c *Consumer) Stats() ConsumerStats {
+	var total ConsumerStats
+	for _, tc := range c.perTopic {
+		st := tc.stats()
+		total.Processed += st.Processed
+		total.Duplicates += st.Duplicates
+		total.DeadLettered += st.DeadLettered
+		total.UnknownFields += st.UnknownFields
+	}
+	return total
+}
+
+// TopicStats returns the counters of every subscribed topic.
+func (c *Consumer) TopicStats() map[string]ConsumerStats {
+	out := make(map[string]ConsumerStats, len(c.perTopic))
+	for t, tc := range c.perTopic {
+		out[t] = tc.stats()
+	}
+	return out
 }
 
 type ConsumerConfig struct {
-	Brokers  []string
-	Topic    string
-	GroupID  string
-	MinBytes int
-	MaxBytes int
+	Brokers []string
+	// Conn carries TLS and SASL settings; nil connects in plaintext.
+	Conn *kafkaconn.Conn
+	// Topics and every topic whose full name matches TopicPattern (a
+	// regexp, resolved once at startup) are consumed by one group. All of
+	// them must carry the same order schema.
+	Topics       []string
+	TopicPattern string
+	GroupID      string
+	MinBytes     int
+	MaxBytes     int
+
+	// Decoder maps message values to orders; nil means NewDecoder in
+	// strict mode.
+	Decoder *Decoder
+
+	// DeadLetterTopic receives undecodable and invalid messages. Empty
+	// keeps the old behavior of logging and skipping them.
+	DeadLetterTopic string
+	// DeadLetters, if set, replaces the writer for DeadLetterTopic.
+	DeadLetters DeadLetterPublisher
+	// Retry applies to ingest errors that are not validation failures.
+	// Zero attempts, backoffs and multiplier fall back to
+	// DefaultRetryPolicy; a zero Jitter means none.
+	Retry RetryPolicy
+	// Workers is the number of lanes processing messages concurrently;
+	// values below 1 mean one.
+	Workers int
+	// BatchSize > 1 switches lanes to micro-batches: up to BatchSize
+	// messages, or whatever arrived within BatchTimeout of the first one,
+	// are stored in a single repository transaction.
+	BatchSize    int
+	BatchTimeout time.Duration
 }
 
-func NewConsumer(cfg ConsumerConfig, svc *service.OrderService) *Consumer {
+// NewConsumer joins cfg.GroupID on the brokers and hands the orders it
+// reads to uc.
+func NewConsumer(ctx context.Context, cfg ConsumerConfig, uc inbound.OrderUseCase) (*Consumer, error) {
+	client := cfg.Conn.Client(cfg.Brokers)
+	topics, err := resolveTopics(ctx, client, cfg.Topics, cfg.TopicPattern)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Topics = topics
+
 	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  cfg.Brokers,
-		Topic:    cfg.Topic,
-		GroupID:  cfg.GroupID,
-		MinBytes: cfg.MinBytes,
-		MaxBytes: cfg.MaxBytes,
+		Brokers:     cfg.Brokers,
+		Dialer:      cfg.Conn.Dialer(),
+		GroupTopics: topics,
+		GroupID:     cfg.GroupID,
+		MinBytes:    cfg.MinBytes,
+		MaxBytes:    cfg.MaxBytes,
 	})
-	return &Consumer{reader: r, svc: svc}
+	if cfg.DeadLetters == nil && cfg.DeadLetterTopic != "" {
+		cfg.DeadLetters = NewDeadLetterQueue(cfg.Brokers, cfg.Conn, cfg.DeadLetterTopic)
+	}
+
+	c, err := NewSourceConsumer(r, cfg, uc)
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	c.client = client
+	log.Printf("[kafka] consuming %s as group %s", topicList(topics), cfg.GroupID)
+	return c, nil
+}
+
+// NewSourceConsumer returns a consumer reading from src instead of the
+// brokers, e.g. a kafkatest.Source. cfg.Topics names the topics counted
+// on the status page; the broker settings, TopicPattern and
+// DeadLetterTopic are ignored.
+func NewSourceConsumer(src MessageSource, cfg ConsumerConfig, uc inbound.OrderUseCase) (*Consumer, error) {
+	dec := cfg.Decoder
+	if dec == nil {
+		var err error
+		if dec, err = NewDecoder(DecodeStrict); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Consumer{
+		source:   src,
+		decoder:  dec,
+		topics:   cfg.Topics,
+		group:    cfg.GroupID,
+		dlq:      cfg.DeadLetters,
+		retry:    cfg.Retry.withDefaults(),
+		workers:  max(cfg.Workers, 1),
+		uc:       uc,
+		perTopic: make(map[string]*topicCounters, len(cfg.Topics)),
+	}
+	for _, t := range cfg.Topics {
+		c.perTopic[t] = &topicCounters{}
+	}
+	if cfg.BatchSize > 1 {
+		c.batch = cfg.BatchSize
+		c.wait = cfg.BatchTimeout
+		if c.wait <= 0 {
+			c.wait = 100 * time.Millisecond
+		}
+	}
+	return c, nil
 }
 
 func (c *Consumer) Close() error {
-	return c.reader.Close()
+	err := c.source.Close()
+	if c.dlq != nil {
+		err = errors.Join(err, c.dlq.Close())
+	}
+	return err
 }
 
+// Run fetches messages and hands them to the worker lanes until ctx is
+// cancelled. Messages with the same key (or, without a key, from the same
+// partition) always go to the same lane and are processed in order.
 func (c *Consumer) Run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tracker := newOffsetTracker()
+	done := make(chan kafka.Message, c.workers*laneBuffer)
+	lanes := make([]chan kafka.Message, c.workers)
+
+	var wg sync.WaitGroup
+	for i := range lanes {
+		lanes[i] = make(chan kafka.Message, laneBuffer)
+		wg.Add(1)
+		go func(in <-chan kafka.Message) {
+			defer wg.Done()
+			if c.batch > 1 {
+				c.batchLane(ctx, in, done)
+				return
+			}
+			for msg := range in {
+				if c.handle(ctx, msg) {
+					done <- msg
+				}
+			}
+		}(lanes[i])
+	}
+
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		c.commitLoop(ctx, tracker, done)
+	}()
+
+	c.fetchLoop(ctx, tracker, lanes)
+
+	for _, l := range lanes {
+		close(l)
+	}
+	wg.Wait()
+	close(done)
+	<-committed
+}
+
+// laneBuffer bounds how many fetched messages may wait per lane, which
+// also bounds how far commits can lag behind fetching.
+const laneBuffer = 16
+
+// commitTimeout bounds one offset commit, which may run after Run's ctx
+// was cancelled.
+const commitTimeout = 5 * time.Second
+
+func (c *Consumer) fetchLoop(ctx context.Context, tracker *offsetTracker, lanes []chan kafka.Message) {
 	for {
-		msg, err := c.reader.FetchMessage(ctx)
+		if _, err := c.waitResumed(ctx); err != nil {
+			return
+		}
+
+		msg, err := c.source.FetchMessage(ctx)
 		if err != nil {
 			// normal shutdown
 			if errors.Is(err, context.Canceled) {
@@ -52,21 +276,318 @@ func (c *Consumer) Run(ctx context.Context) {
 			continue
 		}
 
-		order, derr := DecodeOrder(msg.Value)
-		if derr != nil {
-			log.Printf("[kafka] bad message (skip+commit) key=%s err=%v", string(msg.Key), derr)
-			_ = c.reader.CommitMessages(ctx, msg) // commit poison pill
+		tracker.track(msg)
+		select {
+		case lanes[c.lane(msg)] <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Consumer) lane(msg kafka.Message) int {
+	if c.workers == 1 {
+		return 0
+	}
+	if len(msg.Key) == 0 {
+		return msg.Partition % c.workers
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(msg.Key)
+	return int(h.Sum32() % uint32(c.workers))
+}
+
+// commitLoop commits the contiguous processed prefix of every partition,
+// batching whatever finished while the previous commit was in flight.
+func (c *Consumer) commitLoop(ctx context.Context, tracker *offsetTracker, done <-chan kafka.Message) {
+	for msg := range done {
+		ready := make(map[topicPartition]kafka.Message)
+		collect := func(m kafka.Message) {
+			if up, ok := tracker.complete(m); ok {
+				ready[topicPartition{up.Topic, up.Partition}] = up
+			}
+		}
+
+		collect(msg)
+	drain:
+		for {
+			select {
+			case m, ok := <-done:
+				if !ok {
+					break drain
+				}
+				collect(m)
+			default:
+				break drain
+			}
+		}
+
+		if len(ready) == 0 {
 			continue
 		}
+		msgs := make([]kafka.Message, 0, len(ready))
+		for _, m := range ready {
+			msgs = append(msgs, m)
+		}
+		// commits outlive ctx: messages that finished while Run drained on
+		// shutdown must still be committed, or every deploy redelivers them
+		cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), commitTimeout)
+		err := c.source.CommitMessages(cctx, msgs...)
+		cancel()
+		if err != nil {
+			log.Printf("[kafka] commit error: %v", err)
+		}
+	}
+}
+
+// batchLane collects messages from in into micro-batches and flushes each
+// one when it is full or BatchTimeout after its first message arrived.
+func (c *Consumer) batchLane(ctx context.Context, in <-chan kafka.Message, done chan<- kafka.Message) {
+	batch := make([]kafka.Message, 0, c.batch)
+	timer := time.NewTimer(c.wait)
+	timer.Stop()
+
+	flush := func() {
+		timer.Stop()
+		c.flush(ctx, batch, done)
+		batch = batch[:0]
+	}
 
-		if err := c.svc.Ingest(ctx, order); err != nil {
-			log.Printf("[kafka] ingest failed (no commit) order_uid=%s err=%v", order.OrderUID, err)
-			time.Sleep(1 * time.Second)
+	for {
+		select {
+		case msg, ok := <-in:
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) == 1 {
+				timer.Reset(c.wait)
+			}
+			if len(batch) >= c.batch {
+				flush()
+			}
+		case <-timer.C:
+			if len(batch) > 0 {
+				flush()
+			}
+		}
+	}
+}
+
+// flush stores the decodable orders of a batch with one IngestMessages call.
+// If that fails, the batch is replayed message by message through handle,
+// so the retry policy and the dead-letter topic apply to the one record
+// that caused it while the rest still get in.
+func (c *Consumer) flush(ctx context.Context, msgs []kafka.Message, done chan<- kafka.Message) {
+	orders := make([]domain.OrderMessage, 0, len(msgs))
+	ok := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		om, err := c.decode(messageContext(ctx, msg), msg)
+		if err != nil {
+			// dead-letter it now; the rest of the batch does not depend on it
+			if c.handle(ctx, msg) {
+				done <- msg
+			}
 			continue
 		}
+		orders = append(orders, om)
+		ok = append(ok, msg)
+	}
+	if len(ok) == 0 {
+		return
+	}
 
-		if err := c.reader.CommitMessages(ctx, msg); err != nil {
-			log.Printf("[kafka] commit error: %v", err)
+	mctxs := make([]context.Context, len(ok))
+	for i, msg := range ok {
+		mctxs[i] = messageContext(ctx, msg)
+	}
+	bctx, span := startBatchSpan(ctx, mctxs)
+	dups, err := c.uc.IngestMessages(bctx, orders)
+	span.End(err)
+	if err == nil {
+		c.count(ok, dups)
+		for _, msg := range ok {
+			done <- msg
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	// one line per message, so each trace and correlation id leads here
+	batch := span.SpanContext().TraceID
+	for i, msg := range ok {
+		log.Printf("[kafka] batch trace_id=%s of %d failed at topic=%s partition=%d offset=%d, retrying it alone: %v %s",
+			batch, len(ok), msg.Topic, msg.Partition, msg.Offset, err, trace.LogFields(mctxs[i]))
+	}
+	for _, msg := range ok {
+		if !c.handle(ctx, msg) {
+			return
+		}
+		done <- msg
+	}
+}
+
+// startBatchSpan starts the span of one transaction for the messages
+// whose contexts are mctxs. A single message keeps its upstream trace as
+// the parent; several start a new trace linking all of theirs. The
+// correlation id is kept when every message carries the same one.
+func startBatchSpan(ctx context.Context, mctxs []context.Context) (context.Context, *trace.Span) {
+	attrs := []string{"messages", strconv.Itoa(len(mctxs))}
+	if len(mctxs) == 1 {
+		return trace.Start(mctxs[0], "kafka.batch", attrs...)
+	}
+
+	links := make([]trace.SpanContext, len(mctxs))
+	corr := trace.CorrelationID(mctxs[0])
+	for i, mctx := range mctxs {
+		links[i] = trace.FromContext(mctx)
+		if trace.CorrelationID(mctx) != corr {
+			corr = ""
+		}
+	}
+	return trace.StartLinked(trace.WithCorrelationID(ctx, corr), "kafka.batch", links, attrs...)
+}
+
+func (c *Consumer) count(msgs []kafka.Message, dups []domain.MessageRef) {
+	for _, msg := range msgs {
+		c.counters(msg.Topic).processed.Add(1)
+	}
+	for _, ref := range dups {
+		c.counters(ref.Topic).duplicates.Add(1)
+	}
+	if len(dups) > 0 {
+		log.Printf("[kafka] skipped %d already processed message(s)", len(dups))
+	}
+}
+
+// decode turns a message into an order attributed to its topic, counting
+// it if lenient mode let unknown fields through.
+func (c *Consumer) decode(ctx context.Context, msg kafka.Message) (domain.OrderMessage, error) {
+	d, err := c.decoder.Decode(msg)
+	if err != nil {
+		return domain.OrderMessage{}, err
+	}
+	if len(d.UnknownFields) > 0 {
+		c.counters(msg.Topic).unknownFields.Add(1)
+		logUnknownFields(ctx, "kafka", msg, d)
+	}
+	return domain.OrderMessage{Ref: messageRef(msg, d), Order: d.Order}, nil
+}
+
+func logUnknownFields(ctx context.Context, tag string, msg kafka.Message, d Decoded) {
+	log.Printf("[%s] ignored unknown fields %s order_uid=%s event_id=%s schema=v%d topic=%s partition=%d offset=%d %s",
+		tag, strings.Join(d.UnknownFields, ","), d.Order.OrderUID, d.EventID(), d.Version, msg.Topic, msg.Partition, msg.Offset, trace.LogFields(ctx))
+}
+
+// messageRef identifies msg in the ledger by its CloudEvent, if it is one,
+// so a re-published event is recognized despite its new offset. Event ids
+// are only unique per source, and a URI cannot contain a space.
+func messageRef(msg kafka.Message, d Decoded) domain.MessageRef {
+	ref := domain.MessageRef{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+	if d.Event != nil {
+		ref.ID = d.Event.Source + " " + d.Event.ID
+	}
+	return ref
+}
+
+// handle processes one message and reports whether it may be committed:
+// ingested, or moved out of the way as a dead letter. It returns false
+// only when ctx was cancelled first. The work is a span in the message's
+// upstream trace.
+func (c *Consumer) handle(ctx context.Context, msg kafka.Message) bool {
+	ctx, span := startMessageSpan(ctx, "kafka.consume", msg)
+
+	om, err := c.decode(ctx, msg)
+	if err != nil {
+		span.End(err)
+		class := ErrorClassDecode
+		if !Retryable(err) {
+			class = ErrorClassInvalid
 		}
+		return c.deadLetter(ctx, msg, class, err)
 	}
+
+	err = c.ingest(ctx, msg, om)
+	span.End(err)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		class := ErrorClassExhausted
+		if !Retryable(err) {
+			class = ErrorClassInvalid
+		}
+		return c.deadLetter(ctx, msg, class, err)
+	}
+	return true
+}
+
+// ingest runs uc.IngestMessages under the retry policy and returns the
+// last error once it is permanent or the attempts are used up. Without a dead-letter
+// topic an exhausted message would be dropped, so it keeps retrying at the
+// maximum backoff instead.
+func (c *Consumer) ingest(ctx context.Context, msg kafka.Message, om domain.OrderMessage) error {
+	for attempt := 1; ; attempt++ {
+		dups, err := c.uc.IngestMessages(ctx, []domain.OrderMessage{om})
+		if err == nil {
+			c.count([]kafka.Message{msg}, dups)
+			return nil
+		}
+		if !Retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		// a pause is usually for maintenance of whatever failed: wait it
+		// out and start counting attempts afresh
+		if waited, werr := c.waitResumed(ctx); werr != nil {
+			return werr
+		} else if waited {
+			attempt = 0
+			continue
+		}
+		if attempt >= c.retry.MaxAttempts && c.dlq != nil {
+			return err
+		}
+
+		delay := c.retry.Backoff(min(attempt, c.retry.MaxAttempts))
+		log.Printf("[kafka] ingest failed (attempt %d/%d, retry in %s) order_uid=%s message_id=%q partition=%d offset=%d err=%v %s",
+			attempt, c.retry.MaxAttempts, delay.Round(time.Millisecond), om.Order.OrderUID, om.Ref.ID, msg.Partition, msg.Offset, err, trace.LogFields(ctx))
+		if err := sleepCtx(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// deadLetter moves a message that can never succeed out of the way by
+// publishing it to the dead-letter topic, retrying until that works so it
+// is not lost. It reports false if ctx was cancelled before that.
+func (c *Consumer) deadLetter(ctx context.Context, msg kafka.Message, class string, cause error) bool {
+	if c.dlq == nil {
+		log.Printf("[kafka] bad message (skip+commit) key=%s event_id=%s class=%s err=%v %s", string(msg.Key), eventID(msg), class, cause, trace.LogFields(ctx))
+		c.counters(msg.Topic).deadLettered.Add(1)
+		return true // commit poison pill
+	}
+
+	for {
+		err := c.dlq.Publish(ctx, msg, class, cause)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		log.Printf("[kafka] dead-letter publish failed (retrying) partition=%d offset=%d err=%v", msg.Partition, msg.Offset, err)
+		if sleepCtx(ctx, 1*time.Second) != nil {
+			return false
+		}
+	}
+
+	log.Printf("[kafka] bad message sent to %s key=%s event_id=%s partition=%d offset=%d class=%s err=%v %s",
+		c.dlq.Topic(), string(msg.Key), eventID(msg), msg.Partition, msg.Offset, class, cause, trace.LogFields(ctx))
+	c.counters(msg.Topic).deadLettered.Add(1)
+	return true
 }
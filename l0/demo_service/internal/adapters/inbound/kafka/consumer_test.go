@@ -0,0 +1,603 @@
+package kafkain_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	kafkain "demo_service/internal/adapters/inbound/kafka"
+	"demo_service/internal/adapters/inbound/kafka/kafkatest"
+	"demo_service/internal/core/domain"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// waitTimeout bounds every wait, so a broken consumer fails the test
+// instead of hanging it.
+const waitTimeout = 5 * time.Second
+
+var errTransient = errors.New("transient failure")
+
+// harness is one consumer wired to fresh fakes.
+type harness struct {
+	src  *kafkatest.Source
+	uc   *kafkatest.UseCase
+	dlq  *kafkatest.DeadLetters
+	c    *kafkain.Consumer
+	stop func()
+}
+
+func fastRetry(attempts int) kafkain.RetryPolicy {
+	return kafkain.RetryPolicy{MaxAttempts: attempts, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+}
+
+// startConsumer runs a consumer configured by cfg until the test ends or
+// finish is called. Topics default to kafkatest.Topic; a nil dlq leaves
+// it without a dead-letter topic.
+func startConsumer(t *testing.T, cfg kafkain.ConsumerConfig, uc *kafkatest.UseCase, dlq *kafkatest.DeadLetters) *harness {
+	t.Helper()
+	h := &harness{src: kafkatest.NewSource(), uc: uc, dlq: dlq}
+	if len(cfg.Topics) == 0 {
+		cfg.Topics = []string{kafkatest.Topic}
+	}
+	if cfg.Retry.MaxAttempts == 0 {
+		cfg.Retry = fastRetry(3)
+	}
+	if dlq != nil {
+		cfg.DeadLetters = dlq
+	}
+
+	c, err := kafkain.NewSourceConsumer(h.src, cfg, uc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.c = c
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		c.Run(ctx)
+	}()
+	var once sync.Once
+	h.stop = func() {
+		once.Do(func() {
+			cancel()
+			select {
+			case <-stopped:
+			case <-time.After(waitTimeout):
+				t.Error("Run did not return after cancel")
+			}
+			if err := c.Close(); err != nil {
+				t.Errorf("close: %v", err)
+			}
+		})
+	}
+	t.Cleanup(h.stop)
+	return h
+}
+
+func (h *harness) waitCommitted(t *testing.T, p int, offset int64) {
+	t.Helper()
+	h.waitTopicCommitted(t, kafkatest.Topic, p, offset)
+}
+
+func (h *harness) waitTopicCommitted(t *testing.T, topic string, p int, offset int64) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(t.Context(), waitTimeout)
+	defer cancel()
+	if err := h.src.WaitCommitted(ctx, topic, p, offset); err != nil {
+		t.Fatalf("%s/%d committed %d, want %d", topic, p, h.src.Committed(topic, p), offset)
+	}
+}
+
+// finish stops the consumer and reports backward commits.
+func (h *harness) finish(t *testing.T) {
+	t.Helper()
+	h.stop()
+	if n := h.src.BackwardCommits(); n > 0 {
+		t.Errorf("%d commit(s) moved an offset back", n)
+	}
+}
+
+// keysOnLanes returns n message keys that Consumer.lane spreads over n
+// different lanes out of workers.
+func keysOnLanes(workers, n int) []string {
+	var keys []string
+	used := make(map[uint32]bool)
+	for i := 0; len(keys) < n; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		if lane := h.Sum32() % uint32(workers); !used[lane] {
+			used[lane] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// TestConsumerCommit feeds orders over two partitions and expects each
+// partition committed to its end with every order ingested once.
+func TestConsumerCommit(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  kafkain.ConsumerConfig
+	}{
+		{"one by one", kafkain.ConsumerConfig{Workers: 3}},
+		{"batches", kafkain.ConsumerConfig{Workers: 2, BatchSize: 4, BatchTimeout: 10 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := startConsumer(t, tt.cfg, kafkatest.NewUseCase(), nil)
+			const n = 20
+			for i := 1; i <= n; i++ {
+				h.src.Add(kafkatest.OrderMessage(i, i%2))
+			}
+			for p := range 2 {
+				h.waitCommitted(t, p, n/2)
+			}
+			h.finish(t)
+
+			if got := len(h.uc.Ingested()); got != n {
+				t.Errorf("ingested %d orders, want %d", got, n)
+			}
+			if st := h.c.Stats(); st.Processed != n || st.DeadLettered != 0 {
+				t.Errorf("stats %+v, want %d processed and none dead-lettered", st, n)
+			}
+		})
+	}
+}
+
+// TestConsumerPoisonPill feeds a payload that cannot be decoded and an
+// order that fails validation, followed by a good order on the same
+// partition. Both must be moved out of the way, to the dead-letter topic
+// if there is one, without holding up the good order.
+func TestConsumerPoisonPill(t *testing.T) {
+	invalid := kafkatest.Order(2)
+	invalid.OrderUID = ""
+	b, err := json.Marshal(invalid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dlq  *kafkatest.DeadLetters
+	}{
+		{"skipped", nil},
+		{"dead-lettered", &kafkatest.DeadLetters{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := startConsumer(t, kafkain.ConsumerConfig{}, kafkatest.NewUseCase(), tt.dlq)
+			h.src.Add(
+				kafka.Message{Topic: kafkatest.Topic, Value: []byte("{not json")},
+				kafka.Message{Topic: kafkatest.Topic, Value: b},
+				kafkatest.OrderMessage(3, 0),
+			)
+			h.waitCommitted(t, 0, 3)
+			h.finish(t)
+
+			if got := len(h.uc.Ingested()); got != 1 {
+				t.Errorf("ingested %d orders, want 1", got)
+			}
+			if st := h.c.Stats(); st.DeadLettered != 2 {
+				t.Errorf("%d messages dead-lettered, want 2", st.DeadLettered)
+			}
+			if tt.dlq == nil {
+				return
+			}
+			letters := h.dlq.Letters()
+			want := []string{kafkain.ErrorClassDecode, kafkain.ErrorClassInvalid}
+			if len(letters) != len(want) {
+				t.Fatalf("%d dead letters, want %d", len(letters), len(want))
+			}
+			for i, l := range letters {
+				if l.Class != want[i] || l.Message.Offset != int64(i) {
+					t.Errorf("dead letter %d: class %q offset %d, want %q offset %d", i, l.Class, l.Message.Offset, want[i], i)
+				}
+			}
+		})
+	}
+}
+
+func TestConsumerRetry(t *testing.T) {
+	// the first two ingest attempts fail; the third must store the order
+	// before the offset is committed
+	t.Run("transient failure", func(t *testing.T) {
+		uc := kafkatest.NewUseCase()
+		uc.Fail = func(_ context.Context, call int, _ []domain.OrderMessage) error {
+			if call <= 2 {
+				return errTransient
+			}
+			return nil
+		}
+		h := startConsumer(t, kafkain.ConsumerConfig{}, uc, &kafkatest.DeadLetters{})
+		h.src.Add(kafkatest.OrderMessage(1, 0))
+		h.waitCommitted(t, 0, 1)
+		h.finish(t)
+
+		if got := uc.Calls(); got != 3 {
+			t.Errorf("%d ingest attempts, want 3", got)
+		}
+		if got := len(uc.Ingested()); got != 1 {
+			t.Errorf("ingested %d orders, want 1", got)
+		}
+		if got := len(h.dlq.Letters()); got != 0 {
+			t.Errorf("%d dead letters, want none", got)
+		}
+	})
+
+	// ingest never succeeds for the first order: after MaxAttempts it must
+	// go to the dead-letter topic and the next one through
+	t.Run("retries exhausted", func(t *testing.T) {
+		uc := kafkatest.NewUseCase()
+		bad := kafkatest.Order(1).OrderUID
+		uc.Fail = func(_ context.Context, _ int, msgs []domain.OrderMessage) error {
+			for _, m := range msgs {
+				if m.Order.OrderUID == bad {
+					return errTransient
+				}
+			}
+			return nil
+		}
+		h := startConsumer(t, kafkain.ConsumerConfig{Retry: fastRetry(2)}, uc, &kafkatest.DeadLetters{})
+		h.src.Add(kafkatest.OrderMessage(1, 0), kafkatest.OrderMessage(2, 0))
+		h.waitCommitted(t, 0, 2)
+		h.finish(t)
+
+		if got := uc.Calls(); got != 3 {
+			t.Errorf("%d ingest attempts, want 2 for the failing order and 1 for the next", got)
+		}
+		letters := h.dlq.Letters()
+		if len(letters) != 1 || letters[0].Class != kafkain.ErrorClassExhausted || !errors.Is(letters[0].Cause, errTransient) {
+			t.Errorf("dead letters %+v, want one %q", letters, kafkain.ErrorClassExhausted)
+		}
+		if got := len(uc.Ingested()); got != 1 {
+			t.Errorf("ingested %d orders, want 1", got)
+		}
+	})
+}
+
+// quiet is how long a paused consumer is watched for activity.
+const quiet = 50 * time.Millisecond
+
+func TestConsumerPause(t *testing.T) {
+	// messages added while paused wait for the resume; only a fetch
+	// already in flight when the pause came may get through
+	t.Run("holds new messages", func(t *testing.T) {
+		h := startConsumer(t, kafkain.ConsumerConfig{}, kafkatest.NewUseCase(), nil)
+		h.src.Add(kafkatest.OrderMessage(1, 0))
+		h.waitCommitted(t, 0, 1)
+
+		h.c.PauseIngestion()
+		if !h.c.IngestionPaused() || !h.c.Status().Paused {
+			t.Error("consumer does not report the pause")
+		}
+		h.src.Add(kafkatest.OrderMessage(2, 0), kafkatest.OrderMessage(3, 0), kafkatest.OrderMessage(4, 0))
+		time.Sleep(quiet)
+		if got := len(h.uc.Ingested()); got > 2 {
+			t.Errorf("ingested %d orders while paused, want at most 2", got)
+		}
+
+		h.c.ResumeIngestion()
+		if h.c.IngestionPaused() {
+			t.Error("consumer still reports the pause after resuming")
+		}
+		h.waitCommitted(t, 0, 4)
+		h.finish(t)
+		if got := len(h.uc.Ingested()); got != 4 {
+			t.Errorf("ingested %d orders, want 4", got)
+		}
+	})
+
+	// a pause during retries is waited out and the attempts counted
+	// afresh: with two attempts the order survives a failure before and
+	// one after the pause
+	t.Run("restarts retries", func(t *testing.T) {
+		var h *harness
+		uc := kafkatest.NewUseCase()
+		uc.Fail = func(_ context.Context, call int, _ []domain.OrderMessage) error {
+			switch call {
+			case 1:
+				h.c.PauseIngestion()
+				return errTransient
+			case 2:
+				return errTransient
+			}
+			return nil
+		}
+		h = startConsumer(t, kafkain.ConsumerConfig{Retry: fastRetry(2)}, uc, &kafkatest.DeadLetters{})
+		h.src.Add(kafkatest.OrderMessage(1, 0))
+
+		deadline := time.Now().Add(waitTimeout)
+		for uc.Calls() < 1 {
+			if time.Now().After(deadline) {
+				t.Fatal("the order never reached the use case")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(quiet)
+		if got := uc.Calls(); got != 1 {
+			t.Fatalf("%d ingest attempts while paused, want 1", got)
+		}
+
+		h.c.ResumeIngestion()
+		h.waitCommitted(t, 0, 1)
+		h.finish(t)
+		if got := uc.Calls(); got != 3 {
+			t.Errorf("%d ingest attempts, want 3", got)
+		}
+		if got := len(uc.Ingested()); got != 1 {
+			t.Errorf("ingested %d orders, want 1", got)
+		}
+		if letters := h.dlq.Letters(); len(letters) != 0 {
+			t.Errorf("dead letters %+v, want none", letters)
+		}
+	})
+}
+
+// TestConsumerShutdown cancels the consumer while two ingests are in
+// flight on separate partitions. Run must return; the one that still
+// completes during the drain must be committed, and the one cut short by
+// the cancellation must stay uncommitted so the next group member reads
+// it again.
+func TestConsumerShutdown(t *testing.T) {
+	uc := kafkatest.NewUseCase()
+	var inFlight sync.WaitGroup
+	inFlight.Add(2)
+	uc.Fail = func(ctx context.Context, call int, msgs []domain.OrderMessage) error {
+		if call <= 2 {
+			return nil
+		}
+		inFlight.Done()
+		<-ctx.Done()
+		if msgs[0].Ref.Partition == 0 {
+			return nil // finished despite the shutdown
+		}
+		return ctx.Err()
+	}
+	h := startConsumer(t, kafkain.ConsumerConfig{Workers: 2}, uc, &kafkatest.DeadLetters{})
+
+	// without keys the lanes go by partition, so both run concurrently
+	unkeyed := func(seq, p int) kafka.Message {
+		m := kafkatest.OrderMessage(seq, p)
+		m.Key = nil
+		return m
+	}
+	h.src.Add(unkeyed(1, 0), unkeyed(2, 1))
+	for p := range 2 {
+		h.waitCommitted(t, p, 1)
+	}
+	h.src.Add(unkeyed(3, 0), unkeyed(4, 1))
+
+	started := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(started)
+	}()
+	select {
+	case <-started:
+	case <-time.After(waitTimeout):
+		t.Fatal("orders never reached the use case")
+	}
+	h.finish(t)
+
+	if got := h.src.Committed(kafkatest.Topic, 0); got != 2 {
+		t.Errorf("partition 0 committed %d after shutdown, want 2: an ingest that finished during the drain was not committed", got)
+	}
+	if got := h.src.Committed(kafkatest.Topic, 1); got != 1 {
+		t.Errorf("partition 1 committed %d after shutdown, want 1: an interrupted ingest was committed", got)
+	}
+	if got := len(h.dlq.Letters()); got != 0 {
+		t.Errorf("%d dead letters, want none: an interrupted message is not poison", got)
+	}
+}
+
+// TestConsumerKeyOrdering interleaves two keys on one partition. Messages
+// of a key must reach the use case one at a time and in offset order,
+// while the other key's lane keeps going: the first message of key A only
+// finishes once key B got through.
+func TestConsumerKeyOrdering(t *testing.T) {
+	const perKey = 6
+	keys := keysOnLanes(4, 2)
+
+	var (
+		mu      sync.Mutex
+		keyOf   = make(map[string]string) // order uid -> key
+		active  = make(map[string]int)
+		last    = map[string]int64{keys[0]: -1, keys[1]: -1}
+		bPassed = make(chan struct{})
+		bOnce   sync.Once
+		blocked bool
+	)
+	uc := kafkatest.NewUseCase()
+	uc.Fail = func(_ context.Context, _ int, msgs []domain.OrderMessage) error {
+		m := msgs[0]
+		mu.Lock()
+		key := keyOf[m.Order.OrderUID]
+		active[key]++
+		if active[key] > 1 {
+			t.Errorf("key %s: two messages in flight at once", key)
+		}
+		if m.Ref.Offset <= last[key] {
+			t.Errorf("key %s: offset %d handled after %d", key, m.Ref.Offset, last[key])
+		}
+		last[key] = m.Ref.Offset
+		first := key == keys[0] && !blocked
+		blocked = blocked || first
+		mu.Unlock()
+
+		if first {
+			select {
+			case <-bPassed:
+			case <-time.After(waitTimeout):
+				t.Errorf("key %s waited for key %s in vain: the lanes do not run in parallel", keys[0], keys[1])
+			}
+		}
+		if key == keys[1] {
+			bOnce.Do(func() { close(bPassed) })
+		}
+
+		mu.Lock()
+		active[key]--
+		mu.Unlock()
+		return nil
+	}
+	h := startConsumer(t, kafkain.ConsumerConfig{Workers: 4}, uc, nil)
+
+	for i := range perKey * 2 {
+		m := kafkatest.OrderMessage(i+1, 0)
+		key := keys[i%2]
+		m.Key = []byte(key)
+		mu.Lock()
+		keyOf[kafkatest.Order(i+1).OrderUID] = key
+		mu.Unlock()
+		h.src.Add(m)
+	}
+	h.waitCommitted(t, 0, perKey*2)
+	h.finish(t)
+
+	if got := len(uc.Ingested()); got != perKey*2 {
+		t.Fatalf("ingested %d orders, want %d", got, perKey*2)
+	}
+}
+
+// TestConsumerBatchFailure puts one bad message in a batch of four. The
+// batch as a whole fails; the others must still be ingested exactly once,
+// the bad one dead-lettered, and the partition committed to its end.
+func TestConsumerBatchFailure(t *testing.T) {
+	bad := kafkatest.Order(2).OrderUID
+	failFor := func(err error) func(context.Context, int, []domain.OrderMessage) error {
+		return func(_ context.Context, _ int, msgs []domain.OrderMessage) error {
+			for _, m := range msgs {
+				if m.Order.OrderUID == bad {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	tests := []struct {
+		name      string
+		undecoded bool // the bad message is not even an order
+		fail      error
+		calls     int
+		class     string
+	}{
+		// dropped before the batch call, which then succeeds
+		{name: "undecodable message", undecoded: true, calls: 1, class: kafkain.ErrorClassDecode},
+		// batch call, then one call per message
+		{name: "rejected by the use case", fail: fmt.Errorf("constraint: %w", domain.ErrInvalidOrder), calls: 5, class: kafkain.ErrorClassInvalid},
+		// batch call, then one call per message and a retry of the bad one
+		{name: "retries exhausted", fail: errTransient, calls: 6, class: kafkain.ErrorClassExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := kafkatest.NewUseCase()
+			if tt.fail != nil {
+				uc.Fail = failFor(tt.fail)
+			}
+			cfg := kafkain.ConsumerConfig{BatchSize: 4, BatchTimeout: time.Minute, Retry: fastRetry(2)}
+			h := startConsumer(t, cfg, uc, &kafkatest.DeadLetters{})
+
+			msgs := []kafka.Message{
+				kafkatest.OrderMessage(1, 0),
+				kafkatest.OrderMessage(2, 0),
+				kafkatest.OrderMessage(3, 0),
+				kafkatest.OrderMessage(4, 0),
+			}
+			if tt.undecoded {
+				msgs[1].Value = []byte("{not json")
+			}
+			h.src.Add(msgs...)
+			h.waitCommitted(t, 0, 4)
+			h.finish(t)
+
+			if got := uc.Calls(); got != tt.calls {
+				t.Errorf("%d ingest calls, want %d", got, tt.calls)
+			}
+			seen := make(map[string]int)
+			for _, m := range uc.Ingested() {
+				seen[m.Order.OrderUID]++
+			}
+			for _, seq := range []int{1, 3, 4} {
+				if n := seen[kafkatest.Order(seq).OrderUID]; n != 1 {
+					t.Errorf("order %d ingested %d times, want once", seq, n)
+				}
+			}
+			if len(seen) != 3 {
+				t.Errorf("ingested %v, want orders 1, 3 and 4", seen)
+			}
+
+			letters := h.dlq.Letters()
+			if len(letters) != 1 || letters[0].Message.Offset != 1 || letters[0].Class != tt.class {
+				t.Fatalf("dead letters %+v, want offset 1 as %q", letters, tt.class)
+			}
+			if st := h.c.Stats(); st.Processed != 3 || st.DeadLettered != 1 {
+				t.Errorf("stats %+v, want 3 processed and 1 dead-lettered", st)
+			}
+		})
+	}
+}
+
+// TestConsumerTopicStats feeds two topics and expects every counter
+// attributed to the topic the message came from.
+func TestConsumerTopicStats(t *testing.T) {
+	dec, err := kafkain.NewDecoder(kafkain.DecodeLenient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := kafkain.ConsumerConfig{Topics: []string{"orders-eu", "orders-us"}, Decoder: dec}
+	h := startConsumer(t, cfg, kafkatest.NewUseCase(), &kafkatest.DeadLetters{})
+
+	on := func(topic string, m kafka.Message) kafka.Message {
+		m.Topic = topic
+		return m
+	}
+	// the same CloudEvent published twice is a duplicate
+	event := func(seq int) kafka.Message {
+		m := kafkatest.OrderMessage(seq, 0)
+		m.Topic = "orders-us"
+		m.Headers = []kafka.Header{
+			{Key: kafkain.HeaderCESpecVersion, Value: []byte("1.0")},
+			{Key: kafkain.HeaderCEID, Value: []byte("evt-1")},
+			{Key: kafkain.HeaderCESource, Value: []byte("/checkout")},
+			{Key: kafkain.HeaderCEType, Value: []byte("com.example.order.created")},
+		}
+		return m
+	}
+	extra := on("orders-eu", kafkatest.OrderMessage(3, 0))
+	extra.Value = append([]byte(`{"gift_wrap":true,`), extra.Value[1:]...)
+
+	h.src.Add(
+		on("orders-eu", kafkatest.OrderMessage(1, 0)),
+		on("orders-eu", kafkatest.OrderMessage(2, 0)),
+		extra,
+		on("orders-eu", kafka.Message{Value: []byte("{not json")}),
+		event(4),
+		event(4),
+	)
+	h.waitTopicCommitted(t, "orders-eu", 0, 4)
+	h.waitTopicCommitted(t, "orders-us", 0, 2)
+	h.finish(t)
+
+	want := map[string]kafkain.ConsumerStats{
+		"orders-eu": {Processed: 3, DeadLettered: 1, UnknownFields: 1},
+		"orders-us": {Processed: 2, Duplicates: 1},
+	}
+	if got := h.c.TopicStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("topic stats %+v, want %+v", got, want)
+	}
+	if got, want := h.c.Stats(), (kafkain.ConsumerStats{Processed: 5, Duplicates: 1, DeadLettered: 1, UnknownFields: 1}); got != want {
+		t.Errorf("stats %+v, want %+v", got, want)
+	}
+}
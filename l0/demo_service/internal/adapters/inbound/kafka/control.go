@@ -0,0 +1,206 @@
+package kafkain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// PauseIngestion stops the consumer from taking new messages. Messages
+// already handed to a lane still finish, and the reader keeps its group
+// membership alive, so pausing does not trigger a rebalance.
+func (c *Consumer) PauseIngestion() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.resumed == nil {
+		c.resumed = make(chan struct{})
+		log.Printf("[kafka] ingestion paused")
+	}
+}
+
+func (c *Consumer) ResumeIngestion() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.resumed != nil {
+		close(c.resumed)
+		c.resumed = nil
+		log.Printf("[kafka] ingestion resumed")
+	}
+}
+
+func (c *Consumer) IngestionPaused() bool {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	return c.resumed != nil
+}
+
+// waitResumed blocks while ingestion is paused. It reports whether it had
+// to wait, and returns ctx's error if ctx ends first.
+func (c *Consumer) waitResumed(ctx context.Context) (bool, error) {
+	c.pauseMu.Lock()
+	ch := c.resumed
+	c.pauseMu.Unlock()
+	if ch == nil {
+		return false, nil
+	}
+
+	select {
+	case <-ch:
+		return true, nil
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+}
+
+// PartitionLag describes how far the consumer group is behind on one
+// partition. Committed is -1 while the group has not committed anything.
+type PartitionLag struct {
+	Topic         string `json:"topic"`
+	Partition     int    `json:"partition"`
+	Committed     int64  `json:"committed"`
+	HighWatermark int64  `json:"high_watermark"`
+	Lag           int64  `json:"lag"`
+}
+
+// Lag asks the brokers for the group's committed offset and the high
+// watermark of every partition of the subscribed topics.
+func (c *Consumer) Lag(ctx context.Context) ([]PartitionLag, error) {
+	return groupLag(ctx, c.client, c.group, c.topics)
+}
+
+func groupLag(ctx context.Context, client *kafka.Client, group string, topics []string) ([]PartitionLag, error) {
+	ranges := make(map[string][]partitionRange, len(topics))
+	ids := make(map[string][]int, len(topics))
+	for _, t := range topics {
+		rs, err := partitionRanges(ctx, client, t)
+		if err != nil {
+			return nil, err
+		}
+		ranges[t] = rs
+		for _, pr := range rs {
+			ids[t] = append(ids[t], pr.partition)
+		}
+	}
+
+	resp, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: group, Topics: ids})
+	if err != nil {
+		return nil, fmt.Errorf("offset fetch %s: %w", group, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("offset fetch %s: %w", group, resp.Error)
+	}
+	committed := make(map[topicPartition]int64)
+	for t, parts := range resp.Topics {
+		for _, p := range parts {
+			if p.Error != nil {
+				return nil, fmt.Errorf("offset fetch %s/%d: %w", t, p.Partition, p.Error)
+			}
+			committed[topicPartition{t, p.Partition}] = p.CommittedOffset
+		}
+	}
+
+	var out []PartitionLag
+	for _, t := range topics {
+		for _, pr := range ranges[t] {
+			pl := PartitionLag{Topic: t, Partition: pr.partition, Committed: -1, HighWatermark: pr.last}
+			if off, ok := committed[topicPartition{t, pr.partition}]; ok && off >= 0 {
+				pl.Committed = off
+			}
+			// nothing committed yet: everything still in the log is pending
+			from := pl.Committed
+			if from < 0 {
+				from = pr.first
+			}
+			pl.Lag = max(pr.last-from, 0)
+			out = append(out, pl)
+		}
+	}
+	return out, nil
+}
+
+// ConsumerStatus is the consumer's entry on the status page.
+type ConsumerStatus struct {
+	Paused     bool                     `json:"paused"`
+	DecodeMode string                   `json:"decode_mode"`
+	Counters   ConsumerStats            `json:"counters"`
+	Topics     map[string]ConsumerStats `json:"topics"`
+	// RefreshedAt is when Partitions and Reader were last collected.
+	RefreshedAt time.Time          `json:"refreshed_at,omitzero"`
+	Partitions  []PartitionLag     `json:"partitions,omitempty"`
+	LagError    string             `json:"lag_error,omitempty"`
+	Reader      *kafka.ReaderStats `json:"reader,omitempty"`
+}
+
+// brokerStatus is the part of ConsumerStatus that costs broker round trips
+// or, for the reader's stats, resets counters; RefreshStatus collects it.
+type brokerStatus struct {
+	at       time.Time
+	lag      []PartitionLag
+	lagError string
+	reader   *kafka.ReaderStats
+}
+
+// lagTimeout bounds one refresh of the partition lag.
+const lagTimeout = 3 * time.Second
+
+// Status returns the consumer's counters together with the lag and reader
+// stats of the last RefreshStatus round, so polling it costs no broker
+// calls.
+func (c *Consumer) Status() ConsumerStatus {
+	c.statusMu.Lock()
+	bs := c.broker
+	c.statusMu.Unlock()
+
+	return ConsumerStatus{
+		Paused:      c.IngestionPaused(),
+		DecodeMode:  c.decoder.Mode(),
+		Counters:    c.Stats(),
+		Topics:      c.TopicStats(),
+		RefreshedAt: bs.at,
+		Partitions:  bs.lag,
+		LagError:    bs.lagError,
+		Reader:      bs.reader,
+	}
+}
+
+// RefreshStatus collects the lag and the reader's stats for Status right
+// away and then every interval, until ctx is done. It is the only caller
+// of the reader's Stats, which resets its counters, so the reported stats
+// cover one interval.
+func (c *Consumer) RefreshStatus(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		c.refreshStatus(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Consumer) refreshStatus(ctx context.Context) {
+	bs := brokerStatus{at: time.Now()}
+	if r, ok := c.source.(*kafka.Reader); ok {
+		rs := r.Stats()
+		bs.reader = &rs
+	}
+	if c.client != nil {
+		ctx, cancel := context.WithTimeout(ctx, lagTimeout)
+		lag, err := c.Lag(ctx)
+		cancel()
+		if err != nil {
+			bs.lagError = err.Error()
+		}
+		bs.lag = lag
+	}
+
+	c.statusMu.Lock()
+	c.broker = bs
+	c.statusMu.Unlock()
+}
@@ -2,25 +2,358 @@ package kafkain
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 
+	"demo_service/internal/adapters/cloudevents"
 	"demo_service/internal/core/domain"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// HeaderContentType names the encoding of a message value; see
+// Decoder.RegisterFormat. Messages without it are JSON.
+const HeaderContentType = cloudevents.HeaderContentType
+
+// ContentTypeJSON is the default content type.
+const ContentTypeJSON = "application/json"
+
+// HeaderSchemaVersion selects the payload schema of a message whose value
+// is a bare order. A value of the form {"schema_version": N, "order": {...}}
+// carries the version itself and takes precedence. Without either, the
+// payload is schema version 1.
+const HeaderSchemaVersion = "schema-version"
+
+// Decode modes for payloads with fields the schema does not know.
+const (
+	DecodeStrict  = "strict"  // reject the message
+	DecodeLenient = "lenient" // ignore the fields, log and count them
 )
 
-func DecodeOrder(b []byte) (domain.Order, error) {
-	var o domain.Order
+// Schema is one version of the order payload.
+type Schema struct {
+	// New returns a pointer to the value the payload is decoded into.
+	New func() any
+	// Upcast converts the decoded value into the current domain order.
+	Upcast func(v any) (domain.Order, error)
+}
+
+// Format converts message values of one content type into the JSON
+// payload of a schema version, which Decoder then decodes as usual.
+type Format interface {
+	// Payload reports fields the conversion itself could not map as
+	// UnknownFields, or fails on them when strict is set.
+	Payload(msg kafka.Message, strict bool) (Payload, error)
+}
+
+// Payload is a message value converted to JSON.
+type Payload struct {
+	JSON          []byte
+	Version       int
+	UnknownFields []string
+}
+
+// Decoder turns message values into orders: the Format registered for the
+// message's content type converts it to JSON, and the Schema registered
+// for its version decodes that.
+type Decoder struct {
+	mode    string
+	formats map[string]Format
+	schemas map[int]Schema
+
+	eventTypes   []string
+	eventSources []string
+}
+
+// NewDecoder returns a decoder in the given mode (DecodeStrict when
+// empty) with JSON, Protobuf and schema version 1, today's order JSON,
+// registered.
+func NewDecoder(mode string) (*Decoder, error) {
+	switch mode {
+	case "":
+		mode = DecodeStrict
+	case DecodeStrict, DecodeLenient:
+	default:
+		return nil, fmt.Errorf("unknown decode mode %q (want strict or lenient)", mode)
+	}
+
+	d := &Decoder{mode: mode, formats: make(map[string]Format), schemas: make(map[int]Schema)}
+	d.RegisterFormat(jsonFormat{}, ContentTypeJSON)
+	d.RegisterFormat(protobufFormat{}, ContentTypesProtobuf...)
+	d.Register(1, Schema{
+		New:    func() any { return &domain.Order{} },
+		Upcast: func(v any) (domain.Order, error) { return *v.(*domain.Order), nil },
+	})
+	return d, nil
+}
+
+// Register adds or replaces the schema of a version. It must not be
+// called while messages are being decoded.
+func (d *Decoder) Register(version int, s Schema) {
+	d.schemas[version] = s
+}
+
+// RegisterFormat makes f decode messages whose content-type header is one
+// of contentTypes, compared without parameters and case. It must not be
+// called while messages are being decoded.
+func (d *Decoder) RegisterFormat(f Format, contentTypes ...string) {
+	for _, ct := range contentTypes {
+		d.formats[mediaType(ct)] = f
+	}
+}
+
+func (d *Decoder) Mode() string { return d.mode }
 
-	dec := json.NewDecoder(bytes.NewReader(b))
-	dec.DisallowUnknownFields()
+// Decoded is a decoded and validated order.
+type Decoded struct {
+	Order   domain.Order
+	Version int
+	// UnknownFields lists the payload fields the schema does not know, as
+	// dotted paths ("payment.tip", "items[].color"). Only lenient mode
+	// gets this far with any.
+	UnknownFields []string
+	// Event is set when the order arrived as a CloudEvent.
+	Event *CloudEvent
+}
 
-	if err := dec.Decode(&o); err != nil {
-		return domain.Order{}, fmt.Errorf("json decode: %w", err)
+// EventID returns the CloudEvent id, or "" for a plain message.
+func (d Decoded) EventID() string {
+	if d.Event == nil {
+		return ""
 	}
+	return d.Event.ID
+}
 
+// envelope is the versioned form of a message value.
+type envelope struct {
+	SchemaVersion json.Number     `json:"schema_version"`
+	Order         json.RawMessage `json:"order"`
+}
+
+// Decode decodes msg and attributes the order to its topic. A CloudEvent
+// is unwrapped first; its data is then decoded like a plain message.
+func (d *Decoder) Decode(msg kafka.Message) (Decoded, error) {
+	ev, msg, err := d.cloudEvent(msg)
+	if err != nil {
+		return Decoded{}, err
+	}
+
+	ct := mediaType(contentType(msg.Headers))
+	if ct == "" {
+		ct = ContentTypeJSON
+	}
+	f, ok := d.formats[ct]
+	if !ok {
+		return Decoded{}, fmt.Errorf("unsupported content type %q", ct)
+	}
+	p, err := f.Payload(msg, d.mode == DecodeStrict)
+	if err != nil {
+		return Decoded{}, err
+	}
+	payload, version, unknown := p.JSON, p.Version, p.UnknownFields
+
+	s, ok := d.schemas[version]
+	if !ok {
+		return Decoded{}, fmt.Errorf("unsupported schema version %d", version)
+	}
+
+	v := s.New()
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	if d.mode == DecodeStrict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return Decoded{}, fmt.Errorf("json decode: %w", err)
+	}
+	if d.mode == DecodeLenient {
+		var raw any
+		if err := json.Unmarshal(payload, &raw); err == nil {
+			unknown = append(unknown, unknownFields(raw, reflect.TypeOf(v), "", nil)...)
+		}
+	}
+
+	o, err := s.Upcast(v)
+	if err != nil {
+		return Decoded{}, fmt.Errorf("upcast schema version %d: %w", version, err)
+	}
 	if err := o.Validate(); err != nil {
-		return domain.Order{}, fmt.Errorf("domain validate: %w", err)
+		return Decoded{}, fmt.Errorf("domain validate: %w", err)
+	}
+	o.SourceTopic = msg.Topic
+
+	slices.Sort(unknown)
+	return Decoded{Order: o, Version: version, UnknownFields: slices.Compact(unknown), Event: ev}, nil
+}
+
+// jsonFormat passes bare orders through and unwraps envelopes.
+type jsonFormat struct{}
+
+func (jsonFormat) Payload(msg kafka.Message, strict bool) (Payload, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Value, &top); err != nil {
+		return Payload{}, fmt.Errorf("json decode: %w", err)
+	}
+
+	if _, ok := top["schema_version"]; !ok {
+		version, err := headerVersion(msg)
+		if err != nil {
+			return Payload{}, err
+		}
+		return Payload{JSON: msg.Value, Version: version}, nil
 	}
 
-	return o, nil
+	var env envelope
+	if err := json.Unmarshal(msg.Value, &env); err != nil {
+		return Payload{}, fmt.Errorf("json decode envelope: %w", err)
+	}
+	n, err := env.SchemaVersion.Int64()
+	if err != nil {
+		return Payload{}, fmt.Errorf("invalid schema_version %q", env.SchemaVersion)
+	}
+	if len(env.Order) == 0 {
+		return Payload{}, errors.New("envelope has no order")
+	}
+
+	var unknown []string
+	for k := range top {
+		if k == "schema_version" || k == "order" {
+			continue
+		}
+		if strict {
+			return Payload{}, fmt.Errorf("json decode envelope: unknown field %q", k)
+		}
+		unknown = append(unknown, "$envelope."+k)
+	}
+	return Payload{JSON: env.Order, Version: int(n), UnknownFields: unknown}, nil
+}
+
+// headerVersion returns the schema-version header of msg, 1 if unset.
+func headerVersion(msg kafka.Message) (int, error) {
+	h := headerValue(msg.Headers, HeaderSchemaVersion)
+	if h == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s header %q", HeaderSchemaVersion, h)
+	}
+	return n, nil
+}
+
+// contentType returns the content-type header, whatever its case:
+// producers disagree on "content-type" and "Content-Type".
+func contentType(headers []kafka.Header) string {
+	return headerValueFold(headers, HeaderContentType)
+}
+
+// headerValueFold is headerValue with the key compared case-insensitively.
+func headerValueFold(headers []kafka.Header, key string) string {
+	for i := len(headers) - 1; i >= 0; i-- {
+		if strings.EqualFold(headers[i].Key, key) {
+			return string(headers[i].Value)
+		}
+	}
+	return ""
+}
+
+// mediaType strips parameters such as charset and lower-cases ct.
+func mediaType(ct string) string {
+	if mt, _, err := mime.ParseMediaType(ct); err == nil {
+		return mt
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+var textUnmarshaler = reflect.TypeFor[encoding.TextUnmarshaler]()
+var jsonUnmarshaler = reflect.TypeFor[json.Unmarshaler]()
+
+// unknownFields walks raw, the generic form of a JSON payload, alongside
+// t and returns the paths of object keys encoding/json would ignore.
+func unknownFields(raw any, t reflect.Type, path string, out []string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// types with their own decoding (time.Time) are leaves
+	if reflect.PointerTo(t).Implements(jsonUnmarshaler) || reflect.PointerTo(t).Implements(textUnmarshaler) {
+		return out
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return out
+		}
+		fields := jsonFields(t)
+		for k, v := range obj {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			// encoding/json matches keys case-insensitively
+			f, ok := fields[strings.ToLower(k)]
+			if !ok {
+				out = append(out, p)
+				continue
+			}
+			out = unknownFields(v, f, p, out)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := raw.([]any)
+		if !ok {
+			return out
+		}
+		for _, v := range arr {
+			out = unknownFields(v, t.Elem(), path+"[]", out)
+		}
+	case reflect.Map:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return out
+		}
+		for k, v := range obj {
+			out = unknownFields(v, t.Elem(), path+"."+k, out)
+		}
+	}
+	return out
+}
+
+// jsonFields maps the lower-cased JSON names of t's fields to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" && tag == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range jsonFields(ft) {
+					fields[k] = v
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+	return fields
 }
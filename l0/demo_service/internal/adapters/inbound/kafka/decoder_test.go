@@ -0,0 +1,178 @@
+package kafkain
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"demo_service/internal/core/domain"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// orderV2 is a made-up schema version 2 that renames order_uid to uid.
+type orderV2 struct {
+	domain.Order
+	UID string `json:"uid"`
+}
+
+// sampleV2 returns the sample order in the orderV2 form.
+func sampleV2(t *testing.T) map[string]any {
+	t.Helper()
+	doc := sampleOrder(t)
+	doc["uid"] = doc["order_uid"]
+	delete(doc, "order_uid")
+	return doc
+}
+
+// decoderV2 returns a decoder in mode with orderV2 registered.
+func decoderV2(t *testing.T, mode string) *Decoder {
+	t.Helper()
+	d, err := NewDecoder(mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Register(2, Schema{
+		New: func() any { return &orderV2{} },
+		Upcast: func(v any) (domain.Order, error) {
+			o := v.(*orderV2)
+			if o.UID == "" {
+				return domain.Order{}, errors.New("uid is empty")
+			}
+			o.Order.OrderUID = o.UID
+			return o.Order, nil
+		},
+	})
+	return d
+}
+
+func encode(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func versionHeader(v string) []kafka.Header {
+	return []kafka.Header{{Key: HeaderSchemaVersion, Value: []byte(v)}}
+}
+
+func TestDecodeSchemaVersion(t *testing.T) {
+	v1, v2 := sampleOrder(t), sampleV2(t)
+	envelope := func(version any, order any) []byte {
+		return encode(t, map[string]any{"schema_version": version, "order": order})
+	}
+
+	tests := []struct {
+		name    string
+		value   []byte
+		headers []kafka.Header
+		want    int
+		wantErr string
+	}{
+		{name: "bare order", value: encode(t, v1), want: 1},
+		{name: "header", value: encode(t, v2), headers: versionHeader("2"), want: 2},
+		{name: "envelope", value: envelope(2, v2), want: 2},
+		// the header would pick version 2, which cannot decode a v1 order
+		{name: "envelope over header", value: envelope(1, v1), headers: versionHeader("2"), want: 1},
+		{name: "envelope version as a string", value: envelope("2", v2), want: 2},
+		{name: "unsupported header version", value: encode(t, v1), headers: versionHeader("7"), wantErr: "unsupported schema version 7"},
+		{name: "unsupported envelope version", value: envelope(7, v1), wantErr: "unsupported schema version 7"},
+		{name: "non-integer header", value: encode(t, v1), headers: versionHeader("two"), wantErr: `invalid schema-version header "two"`},
+		{name: "non-integer envelope version", value: envelope(1.5, v1), wantErr: `invalid schema_version "1.5"`},
+		{name: "envelope without order", value: encode(t, map[string]any{"schema_version": 1}), wantErr: "envelope has no order"},
+		{name: "upcast failure", value: envelope(2, map[string]any{"uid": ""}), wantErr: "upcast schema version 2: uid is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := decoderV2(t, DecodeStrict)
+			got, err := d.Decode(kafka.Message{Topic: "orders", Value: tt.value, Headers: tt.headers})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decode error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version != tt.want {
+				t.Errorf("version %d, want %d", got.Version, tt.want)
+			}
+			if got.Order.OrderUID != v1["order_uid"] || got.Order.SourceTopic != "orders" {
+				t.Errorf("order %q from %q, want %q from orders", got.Order.OrderUID, got.Order.SourceTopic, v1["order_uid"])
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownFields(t *testing.T) {
+	doc := sampleOrder(t)
+	doc["payment"].(map[string]any)["tip"] = 50
+	tip := encode(t, doc)
+	doc["items"].([]any)[0].(map[string]any)["color"] = "red"
+	bare := encode(t, doc)
+	wrapped := encode(t, map[string]any{"schema_version": 1, "order": doc, "x": true})
+
+	tests := []struct {
+		name    string
+		mode    string
+		value   []byte
+		want    []string
+		wantErr string
+	}{
+		{name: "strict nested field", mode: DecodeStrict, value: tip, wantErr: `unknown field "tip"`},
+		{name: "strict envelope field", mode: DecodeStrict, value: wrapped, wantErr: `unknown field "x"`},
+		{name: "lenient", mode: DecodeLenient, value: bare, want: []string{"items[].color", "payment.tip"}},
+		{name: "lenient envelope", mode: DecodeLenient, value: wrapped, want: []string{"$envelope.x", "items[].color", "payment.tip"}},
+		{name: "lenient known fields", mode: DecodeLenient, value: encode(t, sampleOrder(t))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := decoderV2(t, tt.mode)
+			got, err := d.Decode(kafka.Message{Value: tt.value})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decode error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.UnknownFields, tt.want) {
+				t.Errorf("unknown fields %q, want %q", got.UnknownFields, tt.want)
+			}
+		})
+	}
+}
+
+// TestDecodeUnknownFieldsEmbedded checks that the fields of an embedded
+// struct count as known: orderV2 gets order_uid from domain.Order.
+func TestDecodeUnknownFieldsEmbedded(t *testing.T) {
+	doc := sampleV2(t)
+	doc["order_uid"] = doc["uid"]
+	got, err := decoderV2(t, DecodeLenient).Decode(kafka.Message{Value: encode(t, doc), Headers: versionHeader("2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.UnknownFields) > 0 {
+		t.Errorf("unknown fields %q", got.UnknownFields)
+	}
+}
+
+func TestNewDecoderMode(t *testing.T) {
+	for mode, want := range map[string]string{"": DecodeStrict, DecodeStrict: DecodeStrict, DecodeLenient: DecodeLenient} {
+		d, err := NewDecoder(mode)
+		if err != nil || d.Mode() != want {
+			t.Errorf("NewDecoder(%q) = %v, %v, want mode %q", mode, d, err, want)
+		}
+	}
+	if _, err := NewDecoder("loose"); err == nil {
+		t.Error(`NewDecoder("loose") accepted an unknown mode`)
+	}
+}
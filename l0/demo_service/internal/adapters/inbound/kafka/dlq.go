@@ -0,0 +1,94 @@
+package kafkain
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"demo_service/internal/adapters/kafkaconn"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers added to every dead-lettered message. The original key, value and
+// headers are kept as they were.
+const (
+	HeaderDLQOriginalTopic     = "dlq-original-topic"
+	HeaderDLQOriginalPartition = "dlq-original-partition"
+	HeaderDLQOriginalOffset    = "dlq-original-offset"
+	HeaderDLQErrorClass        = "dlq-error-class"
+	HeaderDLQErrorMessage      = "dlq-error-message"
+	HeaderDLQFailedAt          = "dlq-failed-at"
+)
+
+// Error classes recorded in HeaderDLQErrorClass.
+const (
+	ErrorClassDecode    = "decode"    // not a well-formed order payload
+	ErrorClassInvalid   = "invalid"   // decoded but rejected by domain validation
+	ErrorClassExhausted = "exhausted" // transient ingest errors outlasted the retry policy
+)
+
+// DeadLetterQueue publishes messages the consumer cannot process to a
+// separate topic so they can be inspected and re-driven later.
+type DeadLetterQueue struct {
+	topic  string
+	writer *kafka.Writer
+}
+
+func NewDeadLetterQueue(brokers []string, conn *kafkaconn.Conn, topic string) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		topic: topic,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Transport:    conn.Transport(),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (q *DeadLetterQueue) Topic() string { return q.topic }
+
+func (q *DeadLetterQueue) Close() error {
+	return q.writer.Close()
+}
+
+func (q *DeadLetterQueue) Publish(ctx context.Context, msg kafka.Message, class string, cause error) error {
+	if err := q.writer.WriteMessages(ctx, deadLetterMessage(msg, class, cause, time.Now())); err != nil {
+		return fmt.Errorf("publish to %s: %w", q.topic, err)
+	}
+	return nil
+}
+
+// deadLetterMessage keeps the key, value and headers of msg and adds the
+// dlq-* headers describing where and why it failed.
+func deadLetterMessage(msg kafka.Message, class string, cause error, now time.Time) kafka.Message {
+	headers := make([]kafka.Header, 0, len(msg.Headers)+6)
+	for _, h := range msg.Headers {
+		// a re-driven message that fails again gets fresh dlq-* headers
+		if !strings.HasPrefix(h.Key, "dlq-") {
+			headers = append(headers, h)
+		}
+	}
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQOriginalTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderDLQOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderDLQOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: HeaderDLQErrorClass, Value: []byte(class)},
+		kafka.Header{Key: HeaderDLQErrorMessage, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(now.UTC().Format(time.RFC3339Nano))},
+	)
+	return kafka.Message{Key: msg.Key, Value: msg.Value, Headers: headers}
+}
+
+func headerValue(headers []kafka.Header, key string) string {
+	for i := len(headers) - 1; i >= 0; i-- {
+		if headers[i].Key == key {
+			return string(headers[i].Value)
+		}
+	}
+	return ""
+}
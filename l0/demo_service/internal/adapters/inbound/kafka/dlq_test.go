@@ -0,0 +1,95 @@
+package kafkain
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestDeadLetterMessage(t *testing.T) {
+	failedAt := time.Date(2024, 5, 1, 12, 30, 0, 5, time.FixedZone("CEST", 2*3600))
+	msg := kafka.Message{
+		Topic:     "orders-eu",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("order-1"),
+		Value:     []byte(`{"order_uid":"order-1"}`),
+		Headers: []kafka.Header{
+			{Key: "content-type", Value: []byte("application/json")},
+			{Key: HeaderDLQErrorClass, Value: []byte("decode")}, // from an earlier trip through the DLQ
+			{Key: "traceparent", Value: []byte("00-abc-def-01")},
+		},
+	}
+
+	got := deadLetterMessage(msg, ErrorClassInvalid, errors.New("order_uid: required"), failedAt)
+
+	if string(got.Key) != "order-1" || string(got.Value) != `{"order_uid":"order-1"}` {
+		t.Errorf("key/value = %q/%q, want the original ones", got.Key, got.Value)
+	}
+	if got.Topic != "" || got.Partition != 0 || got.Offset != 0 {
+		t.Errorf("dead letter keeps the source position: %s/%d/%d", got.Topic, got.Partition, got.Offset)
+	}
+	want := []kafka.Header{
+		{Key: "content-type", Value: []byte("application/json")},
+		{Key: "traceparent", Value: []byte("00-abc-def-01")},
+		{Key: HeaderDLQOriginalTopic, Value: []byte("orders-eu")},
+		{Key: HeaderDLQOriginalPartition, Value: []byte("3")},
+		{Key: HeaderDLQOriginalOffset, Value: []byte("42")},
+		{Key: HeaderDLQErrorClass, Value: []byte("invalid")},
+		{Key: HeaderDLQErrorMessage, Value: []byte("order_uid: required")},
+		{Key: HeaderDLQFailedAt, Value: []byte("2024-05-01T10:30:00.000000005Z")},
+	}
+	if !reflect.DeepEqual(got.Headers, want) {
+		t.Errorf("headers:\n got %s\nwant %s", headerList(got.Headers), headerList(want))
+	}
+
+	d := toDeadLetter(got)
+	if d.OriginalTopic != "orders-eu" || d.OriginalPartition != 3 || d.OriginalOffset != 42 ||
+		d.ErrorClass != ErrorClassInvalid || d.ErrorMessage != "order_uid: required" {
+		t.Errorf("read back as %+v", d)
+	}
+}
+
+func TestRedrivenMessage(t *testing.T) {
+	dead := deadLetterMessage(kafka.Message{
+		Topic:   "orders-eu",
+		Key:     []byte("order-1"),
+		Value:   []byte("{}"),
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte("application/json")}},
+	}, ErrorClassExhausted, errors.New("db down"), time.Now())
+
+	m, err := redrivenMessage(dead, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := kafka.Message{
+		Topic:   "orders-eu",
+		Key:     []byte("order-1"),
+		Value:   []byte("{}"),
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte("application/json")}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("redriven = %+v, want %+v", m, want)
+	}
+
+	if m, err := redrivenMessage(dead, "orders-retry"); err != nil || m.Topic != "orders-retry" {
+		t.Errorf("with a target: topic %q, err %v", m.Topic, err)
+	}
+
+	_, err = redrivenMessage(kafka.Message{Partition: 1, Offset: 7}, "")
+	if err == nil || !strings.Contains(err.Error(), "message 1/7 has no dlq-original-topic header") {
+		t.Errorf("err = %v, want the missing header reported", err)
+	}
+}
+
+func headerList(hs []kafka.Header) string {
+	parts := make([]string, len(hs))
+	for i, h := range hs {
+		parts[i] = h.Key + "=" + string(h.Value)
+	}
+	return strings.Join(parts, ", ")
+}
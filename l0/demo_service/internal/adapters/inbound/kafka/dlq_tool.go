@@ -0,0 +1,212 @@
+package kafkain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"demo_service/internal/adapters/kafkaconn"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DeadLetter is a message read back from the dead-letter topic.
+type DeadLetter struct {
+	Partition int
+	Offset    int64
+	Time      time.Time
+	Key       []byte
+	Value     []byte
+
+	OriginalTopic     string
+	OriginalPartition int
+	OriginalOffset    int64
+	ErrorClass        string
+	ErrorMessage      string
+	FailedAt          string
+}
+
+func toDeadLetter(m kafka.Message) DeadLetter {
+	d := DeadLetter{
+		Partition:     m.Partition,
+		Offset:        m.Offset,
+		Time:          m.Time,
+		Key:           m.Key,
+		Value:         m.Value,
+		OriginalTopic: headerValue(m.Headers, HeaderDLQOriginalTopic),
+		ErrorClass:    headerValue(m.Headers, HeaderDLQErrorClass),
+		ErrorMessage:  headerValue(m.Headers, HeaderDLQErrorMessage),
+		FailedAt:      headerValue(m.Headers, HeaderDLQFailedAt),
+	}
+	d.OriginalPartition, _ = strconv.Atoi(headerValue(m.Headers, HeaderDLQOriginalPartition))
+	d.OriginalOffset, _ = strconv.ParseInt(headerValue(m.Headers, HeaderDLQOriginalOffset), 10, 64)
+	return d
+}
+
+// InspectDeadLetters reads the dead-letter topic from the beginning of
+// every partition, without a consumer group so nothing is committed, and
+// calls fn for each message until limit messages were seen (limit <= 0
+// means all of them).
+func InspectDeadLetters(ctx context.Context, brokers []string, conn *kafkaconn.Conn, topic string, limit int, fn func(DeadLetter)) error {
+	client := conn.Client(brokers)
+
+	ranges, err := partitionRanges(ctx, client, topic)
+	if err != nil {
+		return err
+	}
+
+	seen := 0
+	for _, pr := range ranges {
+		if pr.first >= pr.last {
+			continue
+		}
+
+		r := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:   brokers,
+			Dialer:    conn.Dialer(),
+			Topic:     topic,
+			Partition: pr.partition,
+			MaxBytes:  10e6,
+		})
+		if err := r.SetOffset(pr.first); err != nil {
+			_ = r.Close()
+			return fmt.Errorf("seek partition %d: %w", pr.partition, err)
+		}
+
+		for off := pr.first; off < pr.last; {
+			m, err := r.ReadMessage(ctx)
+			if err != nil {
+				_ = r.Close()
+				return fmt.Errorf("read partition %d: %w", pr.partition, err)
+			}
+			fn(toDeadLetter(m))
+			off = m.Offset + 1
+
+			seen++
+			if limit > 0 && seen >= limit {
+				_ = r.Close()
+				return nil
+			}
+		}
+		_ = r.Close()
+	}
+	return nil
+}
+
+// RedriveConfig controls Redrive.
+type RedriveConfig struct {
+	Brokers []string
+	Conn    *kafkaconn.Conn
+	// DeadLetterTopic is consumed with GroupID, so a re-drive interrupted
+	// halfway resumes where it stopped. Delivery is at-least-once: a message
+	// written but not yet committed when the run stops is sent again.
+	DeadLetterTopic string
+	GroupID         string
+	// Target overrides the topic recorded in the dlq-original-topic header.
+	Target string
+	// Limit stops after that many messages; <= 0 re-drives everything.
+	Limit int
+	// IdleTimeout ends the run once no message arrived for that long. The
+	// clock starts with the first message: before that the reader may
+	// still be joining the group, so the run waits for it as long as the
+	// group has messages left and ends at once if it has none.
+	IdleTimeout time.Duration
+}
+
+// Redrive publishes dead-lettered messages back to their original topic
+// with the dlq-* headers stripped, committing each one on the dead-letter
+// topic after it was written, so a crash in between re-sends it; the
+// consumer's duplicate ledger only catches that for CloudEvents, whose
+// ids survive the re-publish. It returns how many messages were moved.
+func Redrive(ctx context.Context, cfg RedriveConfig) (int, error) {
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 5 * time.Second
+	}
+
+	lag, err := groupLag(ctx, cfg.Conn.Client(cfg.Brokers), cfg.GroupID, []string{cfg.DeadLetterTopic})
+	if err != nil {
+		return 0, err
+	}
+	var pending int64
+	for _, pl := range lag {
+		pending += pl.Lag
+	}
+	if pending == 0 {
+		return 0, nil
+	}
+
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		Dialer:      cfg.Conn.Dialer(),
+		Topic:       cfg.DeadLetterTopic,
+		GroupID:     cfg.GroupID,
+		StartOffset: kafka.FirstOffset,
+		MaxBytes:    10e6,
+	})
+	defer func() { _ = r.Close() }()
+
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Transport:    cfg.Conn.Transport(),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+	defer func() { _ = w.Close() }()
+
+	moved := 0
+	for cfg.Limit <= 0 || moved < cfg.Limit {
+		var (
+			m   kafka.Message
+			err error
+		)
+		if moved == 0 {
+			// joining the group can take longer than IdleTimeout
+			m, err = r.FetchMessage(ctx)
+		} else {
+			fetchCtx, cancel := context.WithTimeout(ctx, cfg.IdleTimeout)
+			m, err = r.FetchMessage(fetchCtx)
+			cancel()
+		}
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return moved, nil // drained
+			}
+			return moved, fmt.Errorf("fetch: %w", err)
+		}
+
+		out, err := redrivenMessage(m, cfg.Target)
+		if err != nil {
+			return moved, err
+		}
+		if err := w.WriteMessages(ctx, out); err != nil {
+			return moved, fmt.Errorf("write to %s: %w", out.Topic, err)
+		}
+		if err := r.CommitMessages(ctx, m); err != nil {
+			return moved, fmt.Errorf("commit: %w", err)
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// redrivenMessage is m without its dlq-* headers, addressed to target or,
+// when that is empty, to the topic recorded in dlq-original-topic.
+func redrivenMessage(m kafka.Message, target string) (kafka.Message, error) {
+	if target == "" {
+		target = headerValue(m.Headers, HeaderDLQOriginalTopic)
+	}
+	if target == "" {
+		return kafka.Message{}, fmt.Errorf("message %d/%d has no %s header; pass a target topic", m.Partition, m.Offset, HeaderDLQOriginalTopic)
+	}
+
+	var headers []kafka.Header
+	for _, h := range m.Headers {
+		if !strings.HasPrefix(h.Key, "dlq-") {
+			headers = append(headers, h)
+		}
+	}
+	return kafka.Message{Topic: target, Key: m.Key, Value: m.Value, Headers: headers}, nil
+}
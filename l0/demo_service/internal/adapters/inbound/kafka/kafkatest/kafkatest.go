@@ -0,0 +1,19 @@
+package kafkatest
+
+import (
+	"encoding/json"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Topic is the topic of the messages built by OrderMessage.
+const Topic = "orders-kafkatest"
+
+// OrderMessage builds a message carrying Order(seq) on partition p.
+func OrderMessage(seq, p int) kafka.Message {
+	b, err := json.Marshal(Order(seq))
+	if err != nil {
+		panic(err)
+	}
+	return kafka.Message{Topic: Topic, Partition: p, Key: []byte(Order(seq).OrderUID), Value: b}
+}
@@ -0,0 +1,40 @@
+package kafkatest
+
+import (
+	"fmt"
+	"time"
+
+	"demo_service/internal/core/domain"
+)
+
+// Order builds a valid order whose uid and creation time derive from seq.
+func Order(seq int) domain.Order {
+	uid := fmt.Sprintf("kafkatest-%04d", seq)
+	return domain.Order{
+		OrderUID:        uid,
+		TrackNumber:     fmt.Sprintf("TRACK%04d", seq),
+		Entry:           "WBIL",
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		ShardKey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC).Add(time.Duration(seq) * time.Minute),
+		OofShard:        "1",
+		Delivery: domain.Delivery{
+			Name:  "Test Testov",
+			Phone: "+9720000000",
+			City:  "Kiryat Mozkin",
+		},
+		Payment: domain.Payment{
+			Transaction: uid,
+			Currency:    "USD",
+			Provider:    "wbpay",
+			Amount:      453,
+			GoodsTotal:  453,
+		},
+		Items: []domain.Item{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Name: "Mascaras", TotalPrice: 453, NmID: 2389212, Status: 202},
+		},
+	}
+}
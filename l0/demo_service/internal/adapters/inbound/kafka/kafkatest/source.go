@@ -0,0 +1,168 @@
+// Package kafkatest runs the Kafka consumer without a broker or a
+// database: Source is an in-memory MessageSource, UseCase and DeadLetters
+// are fakes of what the consumer hands messages to, and OrderMessage builds
+// the messages to feed it. The consumer's own tests run against them.
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	kafkain "demo_service/internal/adapters/inbound/kafka"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var ErrClosed = errors.New("kafkatest: source closed")
+
+type partition struct {
+	topic string
+	n     int
+}
+
+// Source is a MessageSource fed by Add. Like a group reader, it assigns
+// offsets per partition and commits the offset after the committed
+// message, the next one to read.
+type Source struct {
+	mu        sync.Mutex
+	queue     []kafka.Message
+	next      map[partition]int64
+	committed map[partition]int64
+	backwards int
+	closed    bool
+	changed   chan struct{} // closed and replaced on every change
+}
+
+func NewSource() *Source {
+	return &Source{
+		next:      make(map[partition]int64),
+		committed: make(map[partition]int64),
+		changed:   make(chan struct{}),
+	}
+}
+
+// broadcast wakes everyone waiting on the current state; s.mu is held.
+func (s *Source) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Add queues msgs for FetchMessage, setting their offsets and, if unset,
+// their time. It returns them as the consumer will see them.
+func (s *Source) Add(msgs ...kafka.Message) []kafka.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		p := partition{m.Topic, m.Partition}
+		m.Offset = s.next[p]
+		s.next[p]++
+		if m.Time.IsZero() {
+			m.Time = time.Now()
+		}
+		out[i] = m
+	}
+	s.queue = append(s.queue, out...)
+	s.broadcast()
+	return out
+}
+
+func (s *Source) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return kafka.Message{}, ErrClosed
+		}
+		if len(s.queue) > 0 {
+			m := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return m, nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// CommitMessages fails once ctx is done, as a broker round trip would.
+func (s *Source) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range msgs {
+		p := partition{m.Topic, m.Partition}
+		if cur, ok := s.committed[p]; ok && m.Offset+1 < cur {
+			s.backwards++
+			continue
+		}
+		s.committed[p] = m.Offset + 1
+	}
+	s.broadcast()
+	return nil
+}
+
+func (s *Source) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.broadcast()
+	return nil
+}
+
+// Committed returns the committed offset of a partition: the offset of the
+// first message not yet processed, 0 before any commit.
+func (s *Source) Committed(topic string, part int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.committed[partition{topic, part}]
+}
+
+// BackwardCommits counts commits that would have moved a partition's
+// offset back; the consumer must never make any.
+func (s *Source) BackwardCommits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.backwards
+}
+
+// Pending is the number of added messages not fetched yet.
+func (s *Source) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// WaitCommitted waits until the committed offset of the partition reaches
+// offset, and returns ctx's error if it does not.
+func (s *Source) WaitCommitted(ctx context.Context, topic string, part int, offset int64) error {
+	for {
+		s.mu.Lock()
+		got := s.committed[partition{topic, part}]
+		changed := s.changed
+		s.mu.Unlock()
+		if got >= offset {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+var _ kafkain.MessageSource = (*Source)(nil)
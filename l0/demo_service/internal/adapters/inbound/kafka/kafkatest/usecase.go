@@ -0,0 +1,142 @@
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	kafkain "demo_service/internal/adapters/inbound/kafka"
+	"demo_service/internal/core/domain"
+	"demo_service/internal/ports/inbound"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// UseCase is an in-memory inbound.OrderUseCase that validates orders and
+// keeps a message ledger like the real service.
+type UseCase struct {
+	// Fail, if set, is called at the start of every IngestMessages call,
+	// numbered from 1; a non-nil error fails the call without storing
+	// anything. It may block until ctx is done. Set it before use.
+	Fail func(ctx context.Context, call int, msgs []domain.OrderMessage) error
+
+	mu       sync.Mutex
+	calls    int
+	orders   map[string]domain.Order
+	ledger   map[string]struct{}
+	ingested []domain.OrderMessage
+}
+
+func NewUseCase() *UseCase {
+	return &UseCase{orders: make(map[string]domain.Order), ledger: make(map[string]struct{})}
+}
+
+func (u *UseCase) IngestMessages(ctx context.Context, msgs []domain.OrderMessage) ([]domain.MessageRef, error) {
+	u.mu.Lock()
+	u.calls++
+	call := u.calls
+	u.mu.Unlock()
+
+	if u.Fail != nil {
+		if err := u.Fail(ctx, call, msgs); err != nil {
+			return nil, err
+		}
+	}
+	for _, m := range msgs {
+		if err := m.Order.Validate(); err != nil {
+			return nil, fmt.Errorf("validate %s: %w", m.Order.OrderUID, err)
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var dups []domain.MessageRef
+	for _, m := range msgs {
+		key := m.Ref.LedgerKey()
+		if _, ok := u.ledger[key]; ok {
+			dups = append(dups, m.Ref)
+			continue
+		}
+		u.ledger[key] = struct{}{}
+		u.orders[m.Order.OrderUID] = m.Order
+		u.ingested = append(u.ingested, m)
+	}
+	return dups, nil
+}
+
+// Ingest stores order without a ledger entry and without consulting Fail.
+func (u *UseCase) Ingest(_ context.Context, order domain.Order) error {
+	if err := order.Validate(); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.orders[order.OrderUID] = order
+	return nil
+}
+
+func (u *UseCase) GetByID(_ context.Context, orderUID string) (domain.Order, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	o, ok := u.orders[orderUID]
+	if !ok {
+		return domain.Order{}, domain.ErrNotFound
+	}
+	return o, nil
+}
+
+func (u *UseCase) WarmCache(context.Context, int) (int, error) { return 0, nil }
+
+func (u *UseCase) ListPage(context.Context, int, int) ([]domain.Order, int, error) {
+	return nil, 0, errors.New("kafkatest: ListPage not supported")
+}
+
+// Calls is the number of IngestMessages calls so far, failed ones included.
+func (u *UseCase) Calls() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.calls
+}
+
+// Ingested returns the messages stored so far, in order.
+func (u *UseCase) Ingested() []domain.OrderMessage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]domain.OrderMessage(nil), u.ingested...)
+}
+
+var _ inbound.OrderUseCase = (*UseCase)(nil)
+
+// DeadLetter is a message handed to DeadLetters.
+type DeadLetter struct {
+	Message kafka.Message
+	Class   string
+	Cause   error
+}
+
+// DeadLetters records dead letters instead of publishing them.
+type DeadLetters struct {
+	mu      sync.Mutex
+	letters []DeadLetter
+}
+
+func (d *DeadLetters) Publish(_ context.Context, msg kafka.Message, class string, cause error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.letters = append(d.letters, DeadLetter{Message: msg, Class: class, Cause: cause})
+	return nil
+}
+
+func (d *DeadLetters) Topic() string { return "kafkatest-dlq" }
+
+func (d *DeadLetters) Close() error { return nil }
+
+// Letters returns the dead letters so far, in order.
+func (d *DeadLetters) Letters() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeadLetter(nil), d.letters...)
+}
+
+var _ kafkain.DeadLetterPublisher = (*DeadLetters)(nil)
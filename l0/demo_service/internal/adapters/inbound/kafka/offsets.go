@@ -0,0 +1,139 @@
+package kafkain
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// offsetTracker remembers, per partition, the offsets handed to workers in
+// fetch order. Workers finish out of order, but an offset is only reported
+// as committable once it and everything fetched before it are done, so a
+// crash never skips an unprocessed message.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[topicPartition]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	pending []int64 // fetched and not yet committable, in fetch order
+	done    map[int64]bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[topicPartition]*partitionOffsets)}
+}
+
+// track must be called in fetch order, before the message is dispatched.
+func (t *offsetTracker) track(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tp := topicPartition{msg.Topic, msg.Partition}
+	p := t.partitions[tp]
+	if p == nil {
+		p = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[tp] = p
+	}
+	p.pending = append(p.pending, msg.Offset)
+}
+
+// complete marks msg processed and returns the highest offset of its
+// partition that can now be committed, if the contiguous prefix grew.
+func (t *offsetTracker) complete(msg kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := t.partitions[topicPartition{msg.Topic, msg.Partition}]
+	if p == nil {
+		return kafka.Message{}, false
+	}
+	p.done[msg.Offset] = true
+
+	last, advanced := int64(0), false
+	for len(p.pending) > 0 && p.done[p.pending[0]] {
+		last = p.pending[0]
+		delete(p.done, last)
+		p.pending = p.pending[1:]
+		advanced = true
+	}
+	if !advanced {
+		return kafka.Message{}, false
+	}
+	return kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: last}, true
+}
+
+type partitionRange struct {
+	partition   int
+	first, last int64 // last is the high watermark (next offset to be written)
+}
+
+func partitionRanges(ctx context.Context, client *kafka.Client, topic string) ([]partitionRange, error) {
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("metadata %s: %w", topic, err)
+	}
+	if len(meta.Topics) != 1 {
+		return nil, fmt.Errorf("topic %s not found", topic)
+	}
+	if meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("topic %s: %w", topic, meta.Topics[0].Error)
+	}
+
+	var reqs []kafka.OffsetRequest
+	for _, p := range meta.Topics[0].Partitions {
+		reqs = append(reqs, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+	offs, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: reqs},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list offsets %s: %w", topic, err)
+	}
+
+	var out []partitionRange
+	for _, po := range offs.Topics[topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("offsets %s/%d: %w", topic, po.Partition, po.Error)
+		}
+		out = append(out, partitionRange{partition: po.Partition, first: po.FirstOffset, last: po.LastOffset})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].partition < out[j].partition })
+	return out, nil
+}
+
+// timeOffsets returns, per partition, the offset of the first message with
+// a timestamp at or after t, or -1 if there is none yet.
+func timeOffsets(ctx context.Context, client *kafka.Client, topic string, partitions []int, t time.Time) (map[int]int64, error) {
+	reqs := make([]kafka.OffsetRequest, 0, len(partitions))
+	for _, p := range partitions {
+		reqs = append(reqs, kafka.TimeOffsetOf(p, t))
+	}
+	offs, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: reqs},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list offsets %s at %s: %w", topic, t.Format(time.RFC3339), err)
+	}
+
+	out := make(map[int]int64, len(partitions))
+	for _, po := range offs.Topics[topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("offsets %s/%d: %w", topic, po.Partition, po.Error)
+		}
+		out[po.Partition] = -1
+		for off := range po.Offsets {
+			out[po.Partition] = off
+		}
+	}
+	return out, nil
+}
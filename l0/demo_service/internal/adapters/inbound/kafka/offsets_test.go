@@ -0,0 +1,68 @@
+package kafkain
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOffsetTrackerHoldsAtGap(t *testing.T) {
+	tr := newOffsetTracker()
+	msg := func(off int64) kafka.Message { return kafka.Message{Topic: "orders", Partition: 0, Offset: off} }
+	// a compacted partition skips offsets; only the fetched ones count
+	for _, off := range []int64{0, 1, 2, 5, 6} {
+		tr.track(msg(off))
+	}
+
+	steps := []struct {
+		complete int64
+		want     int64 // -1: nothing committable yet
+	}{
+		{2, -1},
+		{5, -1},
+		{0, 0},
+		{1, 5},
+		{6, 6},
+	}
+	for _, s := range steps {
+		up, ok := tr.complete(msg(s.complete))
+		switch {
+		case s.want < 0 && ok:
+			t.Fatalf("complete(%d) committable up to %d, want to hold at the gap", s.complete, up.Offset)
+		case s.want >= 0 && (!ok || up.Offset != s.want):
+			t.Fatalf("complete(%d) = %d, %v, want %d", s.complete, up.Offset, ok, s.want)
+		}
+	}
+}
+
+func TestOffsetTrackerPartitions(t *testing.T) {
+	tr := newOffsetTracker()
+	a0 := func(off int64) kafka.Message { return kafka.Message{Topic: "a", Partition: 0, Offset: off} }
+	a1 := func(off int64) kafka.Message { return kafka.Message{Topic: "a", Partition: 1, Offset: off} }
+	b0 := func(off int64) kafka.Message { return kafka.Message{Topic: "b", Partition: 0, Offset: off} }
+	for off := range int64(2) {
+		tr.track(a0(off))
+		tr.track(a1(off))
+		tr.track(b0(off))
+	}
+
+	if _, ok := tr.complete(a0(1)); ok {
+		t.Fatal("a/0 committable with offset 0 still pending")
+	}
+	if up, ok := tr.complete(a1(0)); !ok || !samePosition(up, a1(0)) {
+		t.Fatalf("a/1 = %+v, %v, want offset 0: a gap on a/0 must not hold it", up, ok)
+	}
+	if up, ok := tr.complete(b0(0)); !ok || !samePosition(up, b0(0)) {
+		t.Fatalf("b/0 = %+v, %v, want offset 0: same partition number, other topic", up, ok)
+	}
+	if up, ok := tr.complete(a0(0)); !ok || !samePosition(up, a0(1)) {
+		t.Fatalf("a/0 = %+v, %v, want offset 1", up, ok)
+	}
+	if _, ok := tr.complete(kafka.Message{Topic: "c", Offset: 0}); ok {
+		t.Fatal("untracked partition reported committable")
+	}
+}
+
+func samePosition(a, b kafka.Message) bool {
+	return a.Topic == b.Topic && a.Partition == b.Partition && a.Offset == b.Offset
+}
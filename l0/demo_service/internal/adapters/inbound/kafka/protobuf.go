@@ -0,0 +1,217 @@
+package kafkain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ContentTypesProtobuf are the content types decoded as order.proto.
+var ContentTypesProtobuf = []string{"application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf"}
+
+// protoField maps a field number of order.proto to its JSON name.
+type protoField struct {
+	name     string
+	kind     protoKind
+	message  protoMessage // for kindMessage
+	repeated bool
+}
+
+type protoKind int
+
+const (
+	kindString protoKind = iota
+	kindInt64
+	kindMessage
+	kindTimestamp
+)
+
+type protoMessage map[protowire.Number]protoField
+
+var (
+	protoDelivery = protoMessage{
+		1: {name: "name"},
+		2: {name: "phone"},
+		3: {name: "zip"},
+		4: {name: "city"},
+		5: {name: "address"},
+		6: {name: "region"},
+		7: {name: "email"},
+	}
+	protoPayment = protoMessage{
+		1:  {name: "transaction"},
+		2:  {name: "request_id"},
+		3:  {name: "currency"},
+		4:  {name: "provider"},
+		5:  {name: "amount", kind: kindInt64},
+		6:  {name: "payment_dt", kind: kindInt64},
+		7:  {name: "bank"},
+		8:  {name: "delivery_cost", kind: kindInt64},
+		9:  {name: "goods_total", kind: kindInt64},
+		10: {name: "custom_fee", kind: kindInt64},
+	}
+	protoItem = protoMessage{
+		1:  {name: "chrt_id", kind: kindInt64},
+		2:  {name: "track_number"},
+		3:  {name: "price", kind: kindInt64},
+		4:  {name: "rid"},
+		5:  {name: "name"},
+		6:  {name: "sale", kind: kindInt64},
+		7:  {name: "size"},
+		8:  {name: "total_price", kind: kindInt64},
+		9:  {name: "nm_id", kind: kindInt64},
+		10: {name: "brand"},
+		11: {name: "status", kind: kindInt64},
+	}
+	protoOrder = protoMessage{
+		1:  {name: "order_uid"},
+		2:  {name: "track_number"},
+		3:  {name: "entry"},
+		4:  {name: "delivery", kind: kindMessage, message: protoDelivery},
+		5:  {name: "payment", kind: kindMessage, message: protoPayment},
+		6:  {name: "items", kind: kindMessage, message: protoItem, repeated: true},
+		7:  {name: "locale"},
+		8:  {name: "internal_signature"},
+		9:  {name: "customer_id"},
+		10: {name: "delivery_service"},
+		11: {name: "shardkey"},
+		12: {name: "sm_id", kind: kindInt64},
+		13: {name: "date_created", kind: kindTimestamp},
+		14: {name: "oof_shard"},
+	}
+)
+
+// protobufFormat decodes orders.v1.Order messages into the JSON of schema
+// version 1. Unknown field numbers are reported as "#N" paths.
+type protobufFormat struct{}
+
+func (protobufFormat) Payload(msg kafka.Message, strict bool) (Payload, error) {
+	var unknown []string
+	doc, err := decodeProto(msg.Value, protoOrder, "", strict, &unknown)
+	if err != nil {
+		return Payload{}, fmt.Errorf("protobuf decode: %w", err)
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return Payload{}, fmt.Errorf("protobuf decode: %w", err)
+	}
+	return Payload{JSON: b, Version: 1, UnknownFields: unknown}, nil
+}
+
+func decodeProto(b []byte, spec protoMessage, path string, strict bool, unknown *[]string) (map[string]any, error) {
+	doc := make(map[string]any)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f, ok := spec[num]
+		if !ok {
+			p := fmt.Sprintf("%s#%d", dot(path), num)
+			if strict {
+				return nil, fmt.Errorf("unknown field %s", p)
+			}
+			*unknown = append(*unknown, p)
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		var v any
+		switch f.kind {
+		case kindInt64:
+			if typ != protowire.VarintType {
+				return nil, fmt.Errorf("field %s%s: wire type %d, want varint", dot(path), f.name, typ)
+			}
+			x, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b, v = b[n:], int64(x)
+		default:
+			if typ != protowire.BytesType {
+				return nil, fmt.Errorf("field %s%s: wire type %d, want length-delimited", dot(path), f.name, typ)
+			}
+			raw, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+
+			switch f.kind {
+			case kindString:
+				v = string(raw)
+			case kindTimestamp:
+				t, err := decodeTimestamp(raw)
+				if err != nil {
+					return nil, fmt.Errorf("field %s%s: %w", dot(path), f.name, err)
+				}
+				v = t
+			case kindMessage:
+				sub := path + f.name
+				if f.repeated {
+					sub += "[]"
+				}
+				m, err := decodeProto(raw, f.message, sub, strict, unknown)
+				if err != nil {
+					return nil, err
+				}
+				v = m
+			}
+		}
+
+		if f.repeated {
+			list, _ := doc[f.name].([]any)
+			doc[f.name] = append(list, v)
+		} else {
+			doc[f.name] = v // last one wins, as in proto3
+		}
+	}
+	return doc, nil
+}
+
+// decodeTimestamp decodes a google.protobuf.Timestamp.
+func decodeTimestamp(b []byte) (time.Time, error) {
+	var secs, nanos int64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ == protowire.VarintType && (num == 1 || num == 2) {
+			x, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return time.Time{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+			if num == 1 {
+				secs = int64(x)
+			} else {
+				nanos = int64(int32(x))
+			}
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return time.Unix(secs, nanos).UTC(), nil
+}
+
+func dot(path string) string {
+	if path == "" {
+		return ""
+	}
+	return path + "."
+}
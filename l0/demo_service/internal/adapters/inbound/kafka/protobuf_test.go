@@ -0,0 +1,173 @@
+package kafkain
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoDef is a message of order.proto: field name to declaration.
+type protoDef map[string]protoDecl
+
+type protoDecl struct {
+	num      protowire.Number
+	typ      string
+	repeated bool
+}
+
+var (
+	protoMessageLine = regexp.MustCompile(`^message (\w+) \{`)
+	protoFieldLine   = regexp.MustCompile(`^(repeated )?([\w.]+) (\w+) = (\d+);`)
+)
+
+// parseOrderProto reads the messages of order.proto. It understands just
+// the subset the file uses: flat messages of scalar, message and
+// Timestamp fields.
+func parseOrderProto(t *testing.T) map[string]protoDef {
+	t.Helper()
+	f, err := os.Open("order.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	defs := make(map[string]protoDef)
+	var cur protoDef
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.Join(strings.Fields(sc.Text()), " ")
+		if m := protoMessageLine.FindStringSubmatch(line); m != nil {
+			cur = make(protoDef)
+			defs[m[1]] = cur
+			continue
+		}
+		if m := protoFieldLine.FindStringSubmatch(line); m != nil && cur != nil {
+			n, _ := strconv.Atoi(m[4])
+			cur[m[3]] = protoDecl{num: protowire.Number(n), typ: m[2], repeated: m[1] != ""}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(defs["Order"]) == 0 {
+		t.Fatal("order.proto: no fields found in message Order")
+	}
+	return defs
+}
+
+// TestProtoSpecMatchesOrderProto checks the hand-written field tables of
+// protobuf.go against order.proto, both ways.
+func TestProtoSpecMatchesOrderProto(t *testing.T) {
+	defs := parseOrderProto(t)
+	specs := map[string]protoMessage{
+		"Order":    protoOrder,
+		"Delivery": protoDelivery,
+		"Payment":  protoPayment,
+		"Item":     protoItem,
+	}
+	if len(defs) != len(specs) {
+		t.Errorf("order.proto has %d messages, protobuf.go knows %d", len(defs), len(specs))
+	}
+
+	for msg, def := range defs {
+		spec, ok := specs[msg]
+		if !ok {
+			t.Errorf("message %s is not decoded by protobuf.go", msg)
+			continue
+		}
+		for name, d := range def {
+			f, ok := spec[d.num]
+			if !ok || f.name != name {
+				t.Errorf("%s.%s = %d: protobuf.go has %q for that number", msg, name, d.num, f.name)
+				continue
+			}
+			if f.repeated != d.repeated {
+				t.Errorf("%s.%s: repeated %v in protobuf.go, %v in order.proto", msg, name, f.repeated, d.repeated)
+			}
+			var want protoKind
+			switch d.typ {
+			case "string":
+				want = kindString
+			case "int64":
+				want = kindInt64
+			case "google.protobuf.Timestamp":
+				want = kindTimestamp
+			default:
+				want = kindMessage
+				if sub, ok := specs[d.typ]; !ok || len(sub) != len(f.message) {
+					t.Errorf("%s.%s: protobuf.go does not decode it as %s", msg, name, d.typ)
+				}
+			}
+			if f.kind != want {
+				t.Errorf("%s.%s: kind %d in protobuf.go, want %d for %s", msg, name, f.kind, want, d.typ)
+			}
+		}
+		if len(spec) != len(def) {
+			t.Errorf("message %s: protobuf.go has %d fields, order.proto %d", msg, len(spec), len(def))
+		}
+	}
+}
+
+// encodeProto encodes the generic JSON doc as message msg of order.proto,
+// using only the declarations parsed from the file.
+func encodeProto(t *testing.T, defs map[string]protoDef, msg string, doc map[string]any) []byte {
+	t.Helper()
+	var b []byte
+	for name, v := range doc {
+		d, ok := defs[msg][name]
+		if !ok {
+			t.Fatalf("%s has no field %s in order.proto", msg, name)
+		}
+		values := []any{v}
+		if d.repeated {
+			values = v.([]any)
+		}
+		for _, v := range values {
+			switch d.typ {
+			case "string":
+				b = protowire.AppendTag(b, d.num, protowire.BytesType)
+				b = protowire.AppendString(b, v.(string))
+			case "int64":
+				n, err := v.(json.Number).Int64()
+				if err != nil {
+					t.Fatalf("%s.%s: %v", msg, name, err)
+				}
+				b = protowire.AppendTag(b, d.num, protowire.VarintType)
+				b = protowire.AppendVarint(b, uint64(n))
+			case "google.protobuf.Timestamp":
+				ts, err := time.Parse(time.RFC3339Nano, v.(string))
+				if err != nil {
+					t.Fatalf("%s.%s: %v", msg, name, err)
+				}
+				var sub []byte
+				sub = protowire.AppendTag(sub, 1, protowire.VarintType)
+				sub = protowire.AppendVarint(sub, uint64(ts.Unix()))
+				sub = protowire.AppendTag(sub, 2, protowire.VarintType)
+				sub = protowire.AppendVarint(sub, uint64(ts.Nanosecond()))
+				b = protowire.AppendTag(b, d.num, protowire.BytesType)
+				b = protowire.AppendBytes(b, sub)
+			default:
+				b = protowire.AppendTag(b, d.num, protowire.BytesType)
+				b = protowire.AppendBytes(b, encodeProto(t, defs, d.typ, v.(map[string]any)))
+			}
+		}
+	}
+	return b
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	value := encodeProto(t, parseOrderProto(t), "Order", sampleOrder(t))
+
+	d, err := NewDecoder(DecodeStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameOrder(t, d, ContentTypesProtobuf[0], value)
+}
@@ -0,0 +1,310 @@
+package kafkain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"demo_service/internal/adapters/kafkaconn"
+	"demo_service/internal/core/trace"
+	"demo_service/internal/ports/inbound"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Replayer implements inbound.Replayer. It reads partitions directly,
+// without a consumer group, so the live consumer's offsets are untouched,
+// and hands every order to OrderUseCase.Ingest. The processed-message
+// ledger is deliberately bypassed: replayed messages were seen before.
+type Replayer struct {
+	brokers []string
+	conn    *kafkaconn.Conn
+	topics  []string
+	decoder *Decoder
+	uc      inbound.OrderUseCase
+	retry   RetryPolicy
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	status inbound.ReplayStatus
+}
+
+// NewReplayer returns a Replayer for the given topics; a request may omit
+// the topic when there is only one.
+func NewReplayer(brokers []string, conn *kafkaconn.Conn, topics []string, dec *Decoder, uc inbound.OrderUseCase) *Replayer {
+	return &Replayer{
+		brokers: brokers,
+		conn:    conn,
+		topics:  topics,
+		decoder: dec,
+		uc:      uc,
+		retry:   DefaultRetryPolicy.withDefaults(),
+	}
+}
+
+func (r *Replayer) StartReplay(ctx context.Context, req inbound.ReplayRequest) error {
+	if req.Topic == "" {
+		if len(r.topics) != 1 {
+			return fmt.Errorf("%w: topic is required, consuming %s", inbound.ErrInvalidReplay, topicList(r.topics))
+		}
+		req.Topic = r.topics[0]
+	}
+	if req.Rate < 0 {
+		return fmt.Errorf("%w: rate must not be negative", inbound.ErrInvalidReplay)
+	}
+
+	r.mu.Lock()
+	running := r.status.Running
+	r.mu.Unlock()
+	if running {
+		return inbound.ErrReplayRunning
+	}
+
+	parts, err := r.plan(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status.Running {
+		return inbound.ErrReplayRunning
+	}
+
+	// the replay outlives the request that started it
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	r.status = inbound.ReplayStatus{
+		Running:    true,
+		Request:    &req,
+		StartedAt:  time.Now().UTC(),
+		Partitions: parts,
+	}
+	go r.run(runCtx, cancel, req, r.done)
+
+	log.Printf("[replay] started topic=%s partition=%d from_offset=%d from_time=%s rate=%g",
+		req.Topic, req.Partition, req.FromOffset, req.FromTime.Format(time.RFC3339), req.Rate)
+	return nil
+}
+
+func (r *Replayer) CancelReplay() bool {
+	r.mu.Lock()
+	running, cancel := r.status.Running, r.cancel
+	r.mu.Unlock()
+	if running {
+		cancel()
+	}
+	return running
+}
+
+func (r *Replayer) ReplayStatus() inbound.ReplayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st := r.status
+	st.Partitions = append([]inbound.ReplayPartition(nil), st.Partitions...)
+	return st
+}
+
+// Close cancels a running replay and waits for it to stop.
+func (r *Replayer) Close() {
+	r.mu.Lock()
+	done := r.done
+	r.mu.Unlock()
+	if r.CancelReplay() {
+		<-done
+	}
+}
+
+// plan resolves the offset range of every selected partition: from the
+// requested offset or timestamp up to the current high watermark.
+func (r *Replayer) plan(ctx context.Context, req inbound.ReplayRequest) ([]inbound.ReplayPartition, error) {
+	client := r.conn.Client(r.brokers)
+
+	ranges, err := partitionRanges(ctx, client, req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	if req.Partition >= 0 {
+		var one []partitionRange
+		for _, pr := range ranges {
+			if pr.partition == req.Partition {
+				one = append(one, pr)
+			}
+		}
+		if len(one) == 0 {
+			return nil, fmt.Errorf("%w: topic %s has no partition %d", inbound.ErrInvalidReplay, req.Topic, req.Partition)
+		}
+		ranges = one
+	}
+
+	var atTime map[int]int64
+	if !req.FromTime.IsZero() {
+		ids := make([]int, 0, len(ranges))
+		for _, pr := range ranges {
+			ids = append(ids, pr.partition)
+		}
+		if atTime, err = timeOffsets(ctx, client, req.Topic, ids, req.FromTime); err != nil {
+			return nil, err
+		}
+	}
+
+	parts := make([]inbound.ReplayPartition, 0, len(ranges))
+	for _, pr := range ranges {
+		from := req.FromOffset
+		if atTime != nil {
+			from = atTime[pr.partition]
+			if from < 0 {
+				from = pr.last // nothing that recent
+			}
+		}
+		from = min(max(from, pr.first), pr.last)
+		parts = append(parts, inbound.ReplayPartition{Partition: pr.partition, From: from, End: pr.last, Next: from})
+	}
+	return parts, nil
+}
+
+func (r *Replayer) run(ctx context.Context, cancel context.CancelFunc, req inbound.ReplayRequest, done chan struct{}) {
+	defer close(done)
+	defer cancel()
+
+	limit := newRateLimiter(req.Rate)
+	var err error
+	for i := range r.ReplayStatus().Partitions {
+		if err = r.replayPartition(ctx, req.Topic, i, limit); err != nil {
+			break
+		}
+	}
+
+	r.mu.Lock()
+	r.status.Running = false
+	r.status.FinishedAt = time.Now().UTC()
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	st := r.status
+	r.mu.Unlock()
+
+	log.Printf("[replay] finished topic=%s replayed=%d failed=%d err=%v", req.Topic, st.Replayed, st.Failed, err)
+}
+
+func (r *Replayer) replayPartition(ctx context.Context, topic string, idx int, limit *rateLimiter) error {
+	r.mu.Lock()
+	p := r.status.Partitions[idx]
+	r.mu.Unlock()
+	if p.Next >= p.End {
+		return nil
+	}
+
+	rd := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   r.brokers,
+		Dialer:    r.conn.Dialer(),
+		Topic:     topic,
+		Partition: p.Partition,
+		MaxBytes:  10e6,
+	})
+	defer func() { _ = rd.Close() }()
+	if err := rd.SetOffset(p.Next); err != nil {
+		return fmt.Errorf("seek partition %d: %w", p.Partition, err)
+	}
+
+	lastLog := time.Now()
+	for p.Next < p.End {
+		if err := limit.wait(ctx); err != nil {
+			return err
+		}
+		msg, err := rd.ReadMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("read partition %d: %w", p.Partition, err)
+		}
+
+		ok, err := r.ingest(ctx, msg)
+		if err != nil {
+			return err
+		}
+		p.Next = msg.Offset + 1
+
+		r.mu.Lock()
+		r.status.Partitions[idx].Next = p.Next
+		if ok {
+			r.status.Replayed++
+		} else {
+			r.status.Failed++
+		}
+		r.mu.Unlock()
+
+		if time.Since(lastLog) >= 10*time.Second || p.Next >= p.End {
+			log.Printf("[replay] partition %d: offset %d of %d", p.Partition, p.Next, p.End)
+			lastLog = time.Now()
+		}
+	}
+	return nil
+}
+
+// ingest applies one message, retrying transient errors like the live
+// consumer. Messages that can never succeed are counted as failed and
+// skipped; it returns an error only when ctx is cancelled.
+func (r *Replayer) ingest(ctx context.Context, msg kafka.Message) (ok bool, err error) {
+	ctx, span := startMessageSpan(ctx, "replay.ingest", msg)
+	defer func() { span.End(err) }()
+
+	d, derr := r.decoder.Decode(msg)
+	if derr != nil {
+		log.Printf("[replay] skip bad message event_id=%s partition=%d offset=%d err=%v %s", eventID(msg), msg.Partition, msg.Offset, derr, trace.LogFields(ctx))
+		return false, nil
+	}
+	if len(d.UnknownFields) > 0 {
+		logUnknownFields(ctx, "replay", msg, d)
+	}
+	order := d.Order
+
+	for attempt := 1; ; attempt++ {
+		err := r.uc.Ingest(ctx, order)
+		if err == nil {
+			return true, nil
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if !Retryable(err) || attempt >= r.retry.MaxAttempts {
+			log.Printf("[replay] skip order_uid=%s event_id=%s partition=%d offset=%d after %d attempt(s): %v %s",
+				order.OrderUID, d.EventID(), msg.Partition, msg.Offset, attempt, err, trace.LogFields(ctx))
+			return false, nil
+		}
+		if err := sleepCtx(ctx, r.retry.Backoff(attempt)); err != nil {
+			return false, err
+		}
+	}
+}
+
+// rateLimiter spaces calls to wait evenly at the given rate per second.
+type rateLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return nil
+	}
+	now := time.Now()
+	if l.next.After(now) {
+		if err := sleepCtx(ctx, l.next.Sub(now)); err != nil {
+			return err
+		}
+		now = l.next
+	}
+	l.next = now.Add(l.interval)
+	return nil
+}
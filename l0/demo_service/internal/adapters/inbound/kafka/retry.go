@@ -0,0 +1,83 @@
+package kafkain
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"demo_service/internal/core/domain"
+)
+
+// RetryPolicy controls how often a message whose ingestion failed with a
+// retryable error is tried again before it goes to the dead-letter topic.
+type RetryPolicy struct {
+	// MaxAttempts counts the first try; 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt; every further
+	// attempt multiplies it by Multiplier, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter in [0,1] randomizes each delay by up to that fraction, so
+	// consumers that failed together do not retry in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy fills in unset fields of ConsumerConfig.Retry.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	p.Jitter = min(max(p.Jitter, 0), 1)
+	return p
+}
+
+// Backoff returns the delay after the given failed attempt (1-based). It
+// never exceeds MaxBackoff, jitter included.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.Jitter > 0 {
+		d *= 1 - p.Jitter + 2*p.Jitter*rand.Float64()
+	}
+	return time.Duration(min(d, float64(p.MaxBackoff)))
+}
+
+// Retryable reports whether trying the same message again can succeed.
+// Validation failures are permanent; anything else (database down,
+// timeouts) is assumed to be transient.
+func Retryable(err error) bool {
+	return !errors.Is(err, domain.ErrInvalidOrder)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,25 @@
+package kafkain_test
+
+import (
+	"testing"
+	"time"
+
+	kafkain "demo_service/internal/adapters/inbound/kafka"
+)
+
+func TestBackoffNeverExceedsMax(t *testing.T) {
+	p := kafkain.RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+		Jitter:         1,
+	}
+	for attempt := 1; attempt <= p.MaxAttempts; attempt++ {
+		for range 100 {
+			if d := p.Backoff(attempt); d > p.MaxBackoff || d < 0 {
+				t.Fatalf("Backoff(%d) = %s, want within [0, %s]", attempt, d, p.MaxBackoff)
+			}
+		}
+	}
+}
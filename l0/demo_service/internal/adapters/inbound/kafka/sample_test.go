@@ -0,0 +1,63 @@
+package kafkain
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// sampleOrderFile is the order scripts/produce.sh publishes.
+const sampleOrderFile = "../../../../scripts/sample_order.json"
+
+func sampleOrderJSON(t *testing.T) []byte {
+	t.Helper()
+	b, err := os.ReadFile(sampleOrderFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// sampleOrder returns the sample order in its generic JSON form, numbers
+// kept as json.Number.
+func sampleOrder(t *testing.T) map[string]any {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(sampleOrderJSON(t)))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// assertSameOrder decodes value with content type ct and checks that the
+// result is the order the sample JSON decodes to.
+func assertSameOrder(t *testing.T, d *Decoder, ct string, value []byte) {
+	t.Helper()
+	want, err := d.Decode(kafka.Message{Topic: "orders", Value: sampleOrderJSON(t)})
+	if err != nil {
+		t.Fatalf("decode sample JSON: %v", err)
+	}
+
+	got, err := d.Decode(kafka.Message{
+		Topic:   "orders",
+		Value:   value,
+		Headers: []kafka.Header{{Key: HeaderContentType, Value: []byte(ct)}},
+	})
+	if err != nil {
+		t.Fatalf("decode %s: %v", ct, err)
+	}
+	if len(got.UnknownFields) > 0 {
+		t.Errorf("unknown fields %v", got.UnknownFields)
+	}
+
+	gb, _ := json.Marshal(got.Order)
+	wb, _ := json.Marshal(want.Order)
+	if !bytes.Equal(gb, wb) {
+		t.Errorf("decoded %s order\n%s\nwant\n%s", ct, gb, wb)
+	}
+}
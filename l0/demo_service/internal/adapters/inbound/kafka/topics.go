@@ -0,0 +1,79 @@
+package kafkain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// resolveTopics merges the explicit topics with every non-internal topic
+// in the cluster whose full name matches pattern. The pattern is applied
+// once, so topics created later need a restart to be picked up.
+func resolveTopics(ctx context.Context, client *kafka.Client, topics []string, pattern string) ([]string, error) {
+	out := slices.Clone(topics)
+	if pattern != "" {
+		re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("topic pattern: %w", err)
+		}
+		meta, err := client.Metadata(ctx, &kafka.MetadataRequest{})
+		if err != nil {
+			return nil, fmt.Errorf("list topics: %w", err)
+		}
+		for _, t := range meta.Topics {
+			if !t.Internal && t.Error == nil && re.MatchString(t.Name) {
+				out = append(out, t.Name)
+			}
+		}
+	}
+
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if len(out) == 0 {
+		if pattern != "" {
+			return nil, fmt.Errorf("no topic matches %q", pattern)
+		}
+		return nil, errors.New("no topics to consume")
+	}
+	return out, nil
+}
+
+type topicCounters struct {
+	processed     atomic.Uint64
+	duplicates    atomic.Uint64
+	deadLettered  atomic.Uint64
+	unknownFields atomic.Uint64
+}
+
+func (tc *topicCounters) stats() ConsumerStats {
+	return ConsumerStats{
+		Processed:     tc.processed.Load(),
+		Duplicates:    tc.duplicates.Load(),
+		DeadLettered:  tc.deadLettered.Load(),
+		UnknownFields: tc.unknownFields.Load(),
+	}
+}
+
+// counters returns the counters of topic. The map is filled in
+// NewConsumer and never changes, so no lock is needed.
+func (c *Consumer) counters(topic string) *topicCounters {
+	if tc, ok := c.perTopic[topic]; ok {
+		return tc
+	}
+	return &topicCounters{} // not subscribed; counted nowhere
+}
+
+// Topics returns the topics the consumer is subscribed to.
+func (c *Consumer) Topics() []string {
+	return slices.Clone(c.topics)
+}
+
+func topicList(topics []string) string {
+	return strings.Join(topics, ",")
+}
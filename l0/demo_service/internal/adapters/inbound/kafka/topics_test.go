@@ -0,0 +1,99 @@
+package kafkain
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+)
+
+// clusterTopics answers metadata requests with a fixed topic list, so a
+// kafka.Client can be used without a broker.
+type clusterTopics []metadata.ResponseTopic
+
+func (c clusterTopics) RoundTrip(_ context.Context, _ net.Addr, req protocol.Message) (protocol.Message, error) {
+	if _, ok := req.(*metadata.Request); !ok {
+		return nil, fmt.Errorf("unexpected request %T", req)
+	}
+	return &metadata.Response{Topics: c}, nil
+}
+
+func TestResolveTopics(t *testing.T) {
+	client := &kafka.Client{Addr: kafka.TCP("broker:9092"), Transport: clusterTopics{
+		{Name: "orders-eu"},
+		{Name: "orders-us"},
+		{Name: "orders-us-dlq"},
+		{Name: "payments"},
+		{Name: "orders-broken", ErrorCode: 3}, // unknown topic or partition
+		{Name: "__consumer_offsets", IsInternal: true},
+	}}
+
+	tests := []struct {
+		name    string
+		topics  []string
+		pattern string
+		want    []string
+		wantErr string
+	}{
+		{name: "explicit only", topics: []string{"b", "a", "b"}, want: []string{"a", "b"}},
+		{name: "pattern matches whole names", pattern: `orders-(eu|us)`, want: []string{"orders-eu", "orders-us"}},
+		{name: "pattern and explicit merged", topics: []string{"orders-eu", "legacy"}, pattern: `orders-.*`,
+			want: []string{"legacy", "orders-eu", "orders-us", "orders-us-dlq"}},
+		{name: "internal topics skipped", pattern: `.*offsets`, wantErr: `no topic matches ".*offsets"`},
+		{name: "topics with errors skipped", pattern: `orders-broken`, wantErr: `no topic matches "orders-broken"`},
+		{name: "bad pattern", pattern: `orders-(`, wantErr: "topic pattern:"},
+		{name: "nothing", wantErr: "no topics to consume"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveTopics(t.Context(), client, tt.topics, tt.pattern)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("topics = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSourceTopic(t *testing.T) {
+	withTopic := `{"source_topic":"forged",` + strings.TrimPrefix(string(sampleOrderJSON(t)), "{")
+	msg := kafka.Message{Topic: "orders-eu", Value: []byte(withTopic)}
+
+	strict, err := NewDecoder(DecodeStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strict.Decode(msg); err == nil || !strings.Contains(err.Error(), "source_topic") {
+		t.Fatalf("strict: err = %v, want source_topic rejected as unknown", err)
+	}
+
+	lenient, err := NewDecoder(DecodeLenient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := lenient.Decode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Order.SourceTopic != "orders-eu" {
+		t.Errorf("SourceTopic = %q, want the message's topic", d.Order.SourceTopic)
+	}
+	if !slices.Contains(d.UnknownFields, "source_topic") {
+		t.Errorf("unknown fields %v, want source_topic reported", d.UnknownFields)
+	}
+}
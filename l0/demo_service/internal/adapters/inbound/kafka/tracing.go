@@ -0,0 +1,53 @@
+package kafkain
+
+import (
+	"context"
+	"strconv"
+
+	"demo_service/internal/adapters/cloudevents"
+	"demo_service/internal/core/trace"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers the trace context and correlation id of a message are read from.
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+	// HeaderCETraceparent is the CloudEvents distributed tracing extension
+	// in binary mode; traceparent wins if both are set.
+	HeaderCETraceparent = cloudevents.HeaderTraceparent
+)
+
+// correlationHeaders are tried in order; producers disagree on the name.
+var correlationHeaders = []string{"correlation-id", "x-correlation-id", "x-request-id"}
+
+// messageContext returns ctx carrying the upstream trace context and the
+// correlation id of msg. A missing or malformed traceparent is ignored, as
+// the W3C spec asks, and spans started from ctx begin a new trace.
+func messageContext(ctx context.Context, msg kafka.Message) context.Context {
+	tp := headerValueFold(msg.Headers, HeaderTraceparent)
+	if tp == "" {
+		tp = headerValueFold(msg.Headers, HeaderCETraceparent)
+	}
+	if tp != "" {
+		if sc, err := trace.ParseTraceparent(tp); err == nil {
+			sc.TraceState = headerValueFold(msg.Headers, HeaderTracestate)
+			ctx = trace.ContextWithRemote(ctx, sc)
+		}
+	}
+
+	for _, h := range correlationHeaders {
+		if id := headerValueFold(msg.Headers, h); id != "" {
+			return trace.WithCorrelationID(ctx, id)
+		}
+	}
+	return ctx
+}
+
+// startMessageSpan starts a span for processing msg within its upstream
+// trace.
+func startMessageSpan(ctx context.Context, name string, msg kafka.Message) (context.Context, *trace.Span) {
+	return trace.Start(messageContext(ctx, msg), name,
+		"topic", msg.Topic, "partition", strconv.Itoa(msg.Partition), "offset", strconv.FormatInt(msg.Offset, 10))
+}
@@ -0,0 +1,61 @@
+package kafkain
+
+import (
+	"context"
+	"testing"
+
+	"demo_service/internal/core/trace"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func tracedMessage(traceID, correlationID string) kafka.Message {
+	return kafka.Message{Headers: []kafka.Header{
+		{Key: HeaderTraceparent, Value: []byte("00-" + traceID + "-00f067aa0ba902b7-01")},
+		{Key: "correlation-id", Value: []byte(correlationID)},
+	}}
+}
+
+func TestBatchSpan(t *testing.T) {
+	const (
+		traceA = "4bf92f3577b34da6a3ce929d0e0e4736"
+		traceB = "5bf92f3577b34da6a3ce929d0e0e4737"
+	)
+	ctx := t.Context()
+	contexts := func(msgs ...kafka.Message) []context.Context {
+		out := make([]context.Context, len(msgs))
+		for i, m := range msgs {
+			out[i] = messageContext(ctx, m)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name        string
+		msgs        []kafka.Message
+		trace       string // "" for a new trace
+		correlation string
+	}{
+		{"single message", []kafka.Message{tracedMessage(traceA, "c-1")}, traceA, "c-1"},
+		{"shared correlation id", []kafka.Message{tracedMessage(traceA, "c-1"), tracedMessage(traceB, "c-1")}, "", "c-1"},
+		{"different correlation ids", []kafka.Message{tracedMessage(traceA, "c-1"), tracedMessage(traceB, "c-2")}, "", ""},
+		{"one without", []kafka.Message{tracedMessage(traceA, "c-1"), tracedMessage(traceB, "")}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bctx, span := startBatchSpan(ctx, contexts(tt.msgs...))
+			defer span.End(nil)
+
+			sc := trace.FromContext(bctx)
+			if tt.trace != "" && sc.TraceID != tt.trace {
+				t.Errorf("trace %s, want the upstream %s", sc.TraceID, tt.trace)
+			}
+			if tt.trace == "" && (sc.TraceID == traceA || sc.TraceID == traceB) {
+				t.Errorf("batch joined upstream trace %s", sc.TraceID)
+			}
+			if got := trace.CorrelationID(bctx); got != tt.correlation {
+				t.Errorf("correlation id %q, want %q", got, tt.correlation)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Package kafkaconn builds the TLS and SASL settings shared by every Kafka
+// reader, writer and admin client of the service.
+package kafkaconn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASL mechanisms accepted in Config.SASLMechanism.
+const (
+	MechanismPlain       = "plain"
+	MechanismSCRAMSHA256 = "scram-sha-256"
+	MechanismSCRAMSHA512 = "scram-sha-512"
+)
+
+type Config struct {
+	TLS bool
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+	// CertFile and KeyFile enable client certificate authentication; set
+	// both or neither.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables broker certificate checks; dev only.
+	InsecureSkipVerify bool
+
+	// SASLMechanism is empty (no SASL) or one of the Mechanism* constants.
+	SASLMechanism string
+	Username      string
+	Password      string
+}
+
+// Conn holds the parsed security settings. A nil *Conn connects in
+// plaintext without authentication.
+type Conn struct {
+	tls       *tls.Config
+	mechanism sasl.Mechanism
+	transport *kafka.Transport
+}
+
+// New loads certificates and prepares the SASL mechanism. It returns nil
+// when neither TLS nor SASL is configured.
+func New(cfg Config) (*Conn, error) {
+	if !cfg.TLS && cfg.SASLMechanism == "" {
+		return nil, nil
+	}
+
+	c := &Conn{}
+	if cfg.TLS {
+		tc, err := tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		c.tls = tc
+	}
+	if cfg.SASLMechanism != "" {
+		m, err := mechanism(cfg)
+		if err != nil {
+			return nil, err
+		}
+		c.mechanism = m
+	}
+	// one transport, so writers and clients share its connection pool
+	c.transport = &kafka.Transport{TLS: c.tls, SASL: c.mechanism}
+	return c, nil
+}
+
+// Dialer returns the dialer for kafka.ReaderConfig, or nil for the
+// library default.
+func (c *Conn) Dialer() *kafka.Dialer {
+	if c == nil {
+		return nil
+	}
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           c.tls,
+		SASLMechanism: c.mechanism,
+	}
+}
+
+// Transport returns the round tripper for kafka.Writer and kafka.Client.
+func (c *Conn) Transport() kafka.RoundTripper {
+	if c == nil {
+		return kafka.DefaultTransport
+	}
+	return c.transport
+}
+
+// Client returns an admin client for brokers.
+func (c *Conn) Client(brokers []string) *kafka.Client {
+	return &kafka.Client{Addr: kafka.TCP(brokers...), Transport: c.Transport()}
+}
+
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	tc := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read kafka CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka CA file %s contains no PEM certificates", cfg.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("kafka client certificate and key must be set together")
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load kafka client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+func mechanism(cfg Config) (sasl.Mechanism, error) {
+	if cfg.Username == "" {
+		return nil, errors.New("kafka SASL username is required")
+	}
+
+	switch strings.ToLower(cfg.SASLMechanism) {
+	case MechanismPlain:
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case MechanismSCRAMSHA256:
+		m, err := scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+		if err != nil {
+			return nil, fmt.Errorf("kafka SASL: %w", err)
+		}
+		return m, nil
+	case MechanismSCRAMSHA512:
+		m, err := scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+		if err != nil {
+			return nil, fmt.Errorf("kafka SASL: %w", err)
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown kafka SASL mechanism %q (want plain, scram-sha-256 or scram-sha-512)", cfg.SASLMechanism)
+}
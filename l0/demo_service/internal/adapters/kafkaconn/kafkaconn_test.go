@@ -0,0 +1,144 @@
+package kafkaconn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// writeCert writes a self-signed certificate and its key as PEM files in
+// a temporary directory and returns their paths.
+func writeCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kafkaconn-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewRejects(t *testing.T) {
+	certFile, _ := writeCert(t)
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"unknown mechanism", Config{SASLMechanism: "gssapi", Username: "u"}, `unknown kafka SASL mechanism "gssapi"`},
+		{"SASL without credentials", Config{SASLMechanism: MechanismPlain}, "kafka SASL username is required"},
+		{"cert without key", Config{TLS: true, CertFile: certFile}, "certificate and key must be set together"},
+		{"key without cert", Config{TLS: true, KeyFile: certFile}, "certificate and key must be set together"},
+		{"cert as key", Config{TLS: true, CertFile: certFile, KeyFile: certFile}, "load kafka client certificate"},
+		{"unreadable CA file", Config{TLS: true, CAFile: filepath.Join(t.TempDir(), "missing.pem")}, "read kafka CA file"},
+		{"CA file without certificates", Config{TLS: true, CAFile: notPEM}, "contains no PEM certificates"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("New = %v, %v, want error %q", c, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPlaintext(t *testing.T) {
+	// the credentials alone do not switch SASL on
+	c, err := New(Config{Username: "u", Password: "p", CAFile: "/does/not/matter"})
+	if err != nil || c != nil {
+		t.Fatalf("New = %v, %v, want nil for plaintext", c, err)
+	}
+	if c.Dialer() != nil {
+		t.Error("nil Conn returned a dialer")
+	}
+	if c.Transport() != kafka.DefaultTransport {
+		t.Error("nil Conn does not use the default transport")
+	}
+	if cl := c.Client([]string{"broker:9092"}); cl.Transport != kafka.DefaultTransport || cl.Addr.String() != "broker:9092" {
+		t.Errorf("client = %+v", cl)
+	}
+}
+
+func TestNewTLS(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+
+	c, err := New(Config{TLS: true, CAFile: certFile, CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.tls == nil || c.tls.MinVersion != tls.VersionTLS12 || c.tls.InsecureSkipVerify {
+		t.Fatalf("tls config %+v", c.tls)
+	}
+	if c.tls.RootCAs == nil || len(c.tls.Certificates) != 1 {
+		t.Errorf("tls config has %d client certificates and roots %v", len(c.tls.Certificates), c.tls.RootCAs)
+	}
+	if c.mechanism != nil {
+		t.Errorf("mechanism %v without SASL", c.mechanism)
+	}
+	if d := c.Dialer(); d == nil || d.TLS != c.tls {
+		t.Errorf("dialer %+v does not carry the TLS config", d)
+	}
+	if tr, ok := c.Transport().(*kafka.Transport); !ok || tr.TLS != c.tls {
+		t.Errorf("transport %+v does not carry the TLS config", c.Transport())
+	}
+}
+
+func TestNewSASL(t *testing.T) {
+	for _, m := range []string{MechanismPlain, "SCRAM-SHA-256", MechanismSCRAMSHA512} {
+		c, err := New(Config{SASLMechanism: m, Username: "u", Password: "p"})
+		if err != nil {
+			t.Fatalf("%s: %v", m, err)
+		}
+		if c.tls != nil {
+			t.Errorf("%s: TLS enabled without TLS", m)
+		}
+		if want := strings.ToUpper(m); c.mechanism == nil || c.mechanism.Name() != want {
+			t.Errorf("%s: mechanism %v, want %s", m, c.mechanism, want)
+		}
+		if d := c.Dialer(); d == nil || d.SASLMechanism != c.mechanism {
+			t.Errorf("%s: dialer does not carry the mechanism", m)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package kafkaout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"demo_service/internal/adapters/cloudevents"
+	"demo_service/internal/adapters/kafkaconn"
+	"demo_service/internal/core/domain"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers set on every published order event.
+const (
+	HeaderEventID   = "event-id"
+	HeaderEventType = "event-type"
+)
+
+// EventPublisher writes order events to a Kafka topic keyed by order_uid,
+// so all events of one order land in one partition, in outbox order. Each
+// message is also a CloudEvent in binary mode: the ce_* headers carry the
+// attributes and the value is the data.
+type EventPublisher struct {
+	writer *kafka.Writer
+	source string
+}
+
+// NewEventPublisher returns a publisher whose events carry source as their
+// CloudEvents source.
+func NewEventPublisher(brokers []string, conn *kafkaconn.Conn, topic, source string) *EventPublisher {
+	return &EventPublisher{source: source, writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Transport:    conn.Transport(),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// the relay already batches; don't hold a short batch back
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+func (p *EventPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// event is the JSON value of a published message.
+type event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	OrderUID   string          `json:"order_uid"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Order      json.RawMessage `json:"order"`
+}
+
+func (p *EventPublisher) PublishOrderEvents(ctx context.Context, events []domain.OrderEvent) error {
+	msgs := make([]kafka.Message, 0, len(events))
+	for _, e := range events {
+		id := strconv.FormatInt(e.ID, 10)
+		value, err := json.Marshal(event{
+			ID:         id,
+			Type:       e.Type,
+			OrderUID:   e.OrderUID,
+			OccurredAt: e.CreatedAt,
+			Order:      e.Payload,
+		})
+		if err != nil {
+			return fmt.Errorf("encode event %s: %w", id, err)
+		}
+		msgs = append(msgs, kafka.Message{
+			Key:   []byte(e.OrderUID),
+			Value: value,
+			Headers: []kafka.Header{
+				{Key: HeaderEventID, Value: []byte(id)},
+				{Key: HeaderEventType, Value: []byte(e.Type)},
+				{Key: cloudevents.HeaderSpecVersion, Value: []byte(cloudevents.SpecVersion)},
+				{Key: cloudevents.HeaderID, Value: []byte(id)},
+				{Key: cloudevents.HeaderSource, Value: []byte(p.source)},
+				{Key: cloudevents.HeaderType, Value: []byte(e.Type)},
+				{Key: cloudevents.HeaderSubject, Value: []byte(e.OrderUID)},
+				{Key: cloudevents.HeaderTime, Value: []byte(e.CreatedAt.UTC().Format(time.RFC3339Nano))},
+				{Key: cloudevents.HeaderContentType, Value: []byte("application/json")},
+			},
+		})
+	}
+
+	if err := p.writer.WriteMessages(ctx, msgs...); err != nil {
+		return fmt.Errorf("write %d events: %w", len(msgs), err)
+	}
+	return nil
+}
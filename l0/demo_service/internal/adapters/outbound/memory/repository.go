@@ -0,0 +1,262 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"demo_service/internal/core/domain"
+	"demo_service/internal/ports/outbound"
+)
+
+// OrderRepository keeps orders in process memory. It mirrors the postgres
+// adapter: newest date_created first, domain.ErrNotFound for unknown ids,
+// and Upsert fully replaces the stored order including its items.
+type OrderRepository struct {
+	mu     sync.RWMutex
+	orders map[string]domain.Order
+	ledger map[string]time.Time // processed-message key -> when
+
+	outbox     bool
+	events     []domain.OrderEvent // pending, oldest first
+	nextEvent  int64
+	publishing sync.Mutex
+}
+
+func NewOrderRepository() *OrderRepository {
+	return &OrderRepository{orders: make(map[string]domain.Order), ledger: make(map[string]time.Time)}
+}
+
+func (r *OrderRepository) Upsert(ctx context.Context, order domain.Order) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.put(order)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *OrderRepository) UpsertBatch(ctx context.Context, orders []domain.Order) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	for _, o := range orders {
+		r.put(o)
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *OrderRepository) UpsertMessages(ctx context.Context, msgs []domain.OrderMessage) ([]domain.OrderMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	applied := make([]domain.OrderMessage, 0, len(msgs))
+	for _, m := range msgs {
+		key := m.Ref.LedgerKey()
+		if _, seen := r.ledger[key]; seen {
+			continue
+		}
+		r.ledger[key] = time.Now()
+		r.put(m.Order)
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// PruneLedger implements outbound.LedgerStore.
+func (r *OrderRepository) PruneLedger(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for key, at := range r.ledger {
+		if n >= limit {
+			break
+		}
+		if at.Before(cutoff) {
+			delete(r.ledger, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// put stores o and queues its outbox event; r.mu must be held.
+func (r *OrderRepository) put(o domain.Order) {
+	_, exists := r.orders[o.OrderUID]
+	r.orders[o.OrderUID] = cloneOrder(o)
+	if !r.outbox {
+		return
+	}
+
+	typ := domain.EventOrderCreated
+	if exists {
+		typ = domain.EventOrderUpdated
+	}
+	payload, _ := json.Marshal(o) // domain.Order always encodes
+	r.nextEvent++
+	r.events = append(r.events, domain.OrderEvent{
+		ID:        r.nextEvent,
+		Type:      typ,
+		OrderUID:  o.OrderUID,
+		Payload:   payload,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// EnableOutbox makes every stored order also queue an order.created or
+// order.updated event for the relay to publish.
+func (r *OrderRepository) EnableOutbox() {
+	r.mu.Lock()
+	r.outbox = true
+	r.mu.Unlock()
+}
+
+// ProcessOutbox implements outbound.OutboxStore.
+func (r *OrderRepository) ProcessOutbox(ctx context.Context, limit int, publish func(context.Context, []domain.OrderEvent) error) (int, error) {
+	r.publishing.Lock()
+	defer r.publishing.Unlock()
+
+	r.mu.Lock()
+	n := min(limit, len(r.events))
+	batch := append([]domain.OrderEvent(nil), r.events[:n]...)
+	r.mu.Unlock()
+	if n == 0 {
+		return 0, nil
+	}
+
+	err := publish(ctx, batch)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		for i := range r.events[:n] {
+			r.events[i].Attempts++
+		}
+		return 0, fmt.Errorf("publish: %w", err)
+	}
+	r.events = r.events[n:]
+	return n, nil
+}
+
+// PruneOutbox implements outbound.OutboxStore. Sent events are dropped
+// by ProcessOutbox right away, so there is never anything to prune.
+func (r *OrderRepository) PruneOutbox(ctx context.Context, _ time.Time, _ int) (int, error) {
+	return 0, ctx.Err()
+}
+
+func (r *OrderRepository) GetByID(ctx context.Context, orderUID string) (domain.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Order{}, err
+	}
+
+	r.mu.RLock()
+	o, ok := r.orders[orderUID]
+	r.mu.RUnlock()
+	if !ok {
+		return domain.Order{}, domain.ErrNotFound
+	}
+	return cloneOrder(o), nil
+}
+
+func (r *OrderRepository) ListLatest(ctx context.Context, limit int) ([]domain.Order, error) {
+	if limit <= 0 {
+		return []domain.Order{}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	uids := r.sortedUIDs()
+	if len(uids) > limit {
+		uids = uids[:limit]
+	}
+
+	out := make([]domain.Order, 0, len(uids))
+	for _, uid := range uids {
+		out = append(out, cloneOrder(r.orders[uid]))
+	}
+	return out, nil
+}
+
+func (r *OrderRepository) ListOrderUIDs(ctx context.Context, limit, offset int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	uids := r.sortedUIDs()
+	r.mu.RUnlock()
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(uids) || limit <= 0 {
+		return nil, nil
+	}
+	uids = uids[offset:]
+	if len(uids) > limit {
+		uids = uids[:limit]
+	}
+	return uids, nil
+}
+
+func (r *OrderRepository) CountOrders(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	n := len(r.orders)
+	r.mu.RUnlock()
+	return n, nil
+}
+
+// sortedUIDs returns ids ordered by date_created DESC; ties are broken by
+// order_uid so pagination is stable. Callers must hold r.mu.
+func (r *OrderRepository) sortedUIDs() []string {
+	uids := make([]string, 0, len(r.orders))
+	for uid := range r.orders {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool {
+		a, b := r.orders[uids[i]].DateCreated, r.orders[uids[j]].DateCreated
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return uids[i] < uids[j]
+	})
+	return uids
+}
+
+func cloneOrder(o domain.Order) domain.Order {
+	if len(o.Items) == 0 {
+		o.Items = nil
+		return o
+	}
+	items := make([]domain.Item, len(o.Items))
+	copy(items, o.Items)
+	o.Items = items
+	return o
+}
+
+var _ outbound.OrderRepository = (*OrderRepository)(nil)
@@ -0,0 +1,29 @@
+package memory_test
+
+import (
+	"testing"
+
+	"demo_service/internal/adapters/outbound/memory"
+	"demo_service/internal/adapters/outbound/repotest"
+	"demo_service/internal/ports/outbound"
+)
+
+func TestOrderRepository(t *testing.T) {
+	repotest.TestOrderRepository(t, func(t *testing.T) outbound.OrderRepository {
+		return memory.NewOrderRepository()
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	repotest.TestOutbox(t, func(t *testing.T) repotest.OutboxRepository {
+		repo := memory.NewOrderRepository()
+		repo.EnableOutbox()
+		return repo
+	})
+}
+
+func TestLedger(t *testing.T) {
+	repotest.TestLedger(t, func(t *testing.T) repotest.LedgerRepository {
+		return memory.NewOrderRepository()
+	})
+}
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -12,23 +13,36 @@ type DB struct {
 	Pool *pgxpool.Pool
 }
 
-func New(ctx context.Context, databaseURL string) (*DB, error) {
-	cfg, err := pgxpool.ParseConfig(databaseURL)
+// PoolConfig tunes the pgx pool. Zero values keep the pgx defaults.
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	ConnectTimeout    time.Duration
+	PingTimeout       time.Duration
+
+	StatementTimeout time.Duration
+	ApplicationName  string
+}
+
+func New(ctx context.Context, databaseURL string, pc PoolConfig) (*DB, error) {
+	cfg, err := poolConfig(databaseURL, pc)
 	if err != nil {
-		return nil, fmt.Errorf("parse database url: %w", err)
+		return nil, err
 	}
 
-	cfg.MaxConns = 10
-	cfg.MinConns = 2
-	cfg.MaxConnLifetime = 30 * time.Minute
-	cfg.HealthCheckPeriod = 30 * time.Second
-
 	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("create pool: %w", err)
 	}
 
-	ctxPing, cancel := context.WithTimeout(ctx, 5*time.Second)
+	pingTimeout := pc.PingTimeout
+	if pingTimeout <= 0 {
+		pingTimeout = 5 * time.Second
+	}
+	ctxPing, cancel := context.WithTimeout(ctx, pingTimeout)
 	defer cancel()
 	if err := pool.Ping(ctxPing); err != nil {
 		pool.Close()
@@ -38,8 +52,82 @@ func New(ctx context.Context, databaseURL string) (*DB, error) {
 	return &DB{Pool: pool}, nil
 }
 
+// poolConfig parses databaseURL and applies the non-zero fields of pc.
+func poolConfig(databaseURL string, pc PoolConfig) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+
+	if pc.MaxConns > 0 {
+		cfg.MaxConns = pc.MaxConns
+	}
+	if pc.MinConns > 0 {
+		cfg.MinConns = pc.MinConns
+	}
+	if cfg.MinConns > cfg.MaxConns {
+		return nil, fmt.Errorf("pool min conns (%d) > max conns (%d)", cfg.MinConns, cfg.MaxConns)
+	}
+	if pc.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = pc.MaxConnLifetime
+	}
+	if pc.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = pc.MaxConnIdleTime
+	}
+	if pc.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = pc.HealthCheckPeriod
+	}
+	if pc.ConnectTimeout > 0 {
+		cfg.ConnConfig.ConnectTimeout = pc.ConnectTimeout
+	}
+
+	// runtime params are sent in the startup message, so they apply to every
+	// connection the pool opens without an extra round-trip
+	if pc.StatementTimeout > 0 {
+		cfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(pc.StatementTimeout.Milliseconds(), 10)
+	}
+	if pc.ApplicationName != "" {
+		cfg.ConnConfig.RuntimeParams["application_name"] = pc.ApplicationName
+	}
+	return cfg, nil
+}
+
 func (d *DB) Close() {
 	if d != nil && d.Pool != nil {
 		d.Pool.Close()
 	}
 }
+
+type PoolStats struct {
+	MaxConns          int32         `json:"max_conns"`
+	TotalConns        int32         `json:"total_conns"`
+	AcquiredConns     int32         `json:"acquired_conns"`
+	IdleConns         int32         `json:"idle_conns"`
+	ConstructingConns int32         `json:"constructing_conns"`
+	AcquireCount      int64         `json:"acquire_count"`
+	AcquireDuration   time.Duration `json:"acquire_duration_ns"`
+	WaitCount         int64         `json:"wait_count"`
+	WaitDuration      time.Duration `json:"wait_duration_ns"`
+	CanceledAcquires  int64         `json:"canceled_acquire_count"`
+}
+
+// Stats returns a point-in-time snapshot of the pool counters.
+// WaitCount/WaitDuration cover acquires that had to wait for a free connection.
+func (d *DB) Stats() PoolStats {
+	if d == nil || d.Pool == nil {
+		return PoolStats{}
+	}
+	s := d.Pool.Stat()
+	return PoolStats{
+		MaxConns:          s.MaxConns(),
+		TotalConns:        s.TotalConns(),
+		AcquiredConns:     s.AcquiredConns(),
+		IdleConns:         s.IdleConns(),
+		ConstructingConns: s.ConstructingConns(),
+		AcquireCount:      s.AcquireCount(),
+		AcquireDuration:   s.AcquireDuration(),
+		WaitCount:         s.EmptyAcquireCount(),
+		WaitDuration:      s.EmptyAcquireWaitTime(),
+		CanceledAcquires:  s.CanceledAcquireCount(),
+	}
+}
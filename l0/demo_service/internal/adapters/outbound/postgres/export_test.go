@@ -0,0 +1,4 @@
+package postgres
+
+// MigrationLockID is the advisory lock key the migration runner takes.
+var MigrationLockID = advisoryLockID(migrationLockKey)
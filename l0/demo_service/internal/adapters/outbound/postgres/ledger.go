@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PruneLedger implements outbound.LedgerStore.
+func (r *OrderRepository) PruneLedger(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	tag, err := r.pool.Exec(ctx, `
+		DELETE FROM processed_messages
+		WHERE message_key IN (
+			SELECT message_key FROM processed_messages
+			WHERE processed_at < $1
+			LIMIT $2
+		)
+	`, cutoff, limit)
+	if err != nil {
+		return 0, fmt.Errorf("prune ledger: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
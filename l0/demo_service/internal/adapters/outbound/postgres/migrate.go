@@ -2,33 +2,183 @@ package postgres
 
 import (
 	"context"
-	"crypto/sha1"
-	"encoding/binary"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io"
+	"io/fs"
+	"log"
+	"math"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
+	"demo_service/internal/migrations"
+
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Migration is a NNNN_name.up.sql file paired with its optional
+// NNNN_name.down.sql counterpart. Name is the up file name, which is what
+// schema_migrations records.
+//
+// A file whose leading comments contain "-- migrate:no-transaction" runs
+// outside a transaction, one statement at a time (NoTx / DownNoTx). That is
+// required for CREATE INDEX CONCURRENTLY and friends; see applyNoTx for how
+// a failure halfway through is tracked.
+//
+// Migrations registered with RegisterGoMigration carry UpFunc/DownFunc
+// instead of SQL.
 type Migration struct {
-	Version int64
-	Path    string
-	Name    string
-	SQL     string
+	Version  int64
+	Name     string
+	SQL      string
+	Checksum string
+	NoTx     bool
+	DownName string
+	DownSQL  string
+	DownNoTx bool
+
+	UpFunc   GoMigrationFunc
+	DownFunc GoMigrationFunc
+}
+
+const noTxDirective = "migrate:no-transaction"
+
+func (m Migration) HasDown() bool { return m.DownName != "" }
+
+// DriftPolicy decides what RunMigrations does when the applied history no
+// longer matches the migration files.
+type DriftPolicy string
+
+const (
+	DriftFail DriftPolicy = "fail"
+	DriftWarn DriftPolicy = "warn"
+)
+
+type MigrateOptions struct {
+	// OnDrift handles edited or missing applied migrations and pending
+	// migrations older than the newest applied one. Empty means DriftFail.
+	// With DriftWarn the problems are logged and out-of-order migrations
+	// are applied anyway.
+	OnDrift DriftPolicy
+
+	// DryRun, when set, receives the SQL of every planned step instead of
+	// it being executed; schema_migrations is left untouched.
+	DryRun io.Writer
+
+	// LockTimeout bounds the wait for the migrations advisory lock; zero
+	// waits until ctx is done. See withMigrationLock.
+	LockTimeout time.Duration
+
+	// Timeout bounds the run, except for no-transaction steps: those build
+	// indexes concurrently, which on a large table takes as long as it
+	// takes, so they run without a deadline or statement_timeout until done
+	// or ctx is cancelled. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// step is one planned migration in either direction.
+type step struct {
+	m    Migration
+	down bool
+}
+
+func (s step) file() string {
+	if s.down {
+		return s.m.DownName
+	}
+	return s.m.Name
+}
+
+func (s step) sql() string {
+	if s.down {
+		return s.m.DownSQL
+	}
+	return s.m.SQL
 }
 
-func RunMigrations(ctx context.Context, pool *pgxpool.Pool, dir string) error {
-	if dir == "" {
-		dir = "internal/migrations"
+func (s step) fn() GoMigrationFunc {
+	if s.down {
+		return s.m.DownFunc
 	}
+	return s.m.UpFunc
+}
 
-	migs, err := loadMigrations(dir)
+func (s step) noTx() bool {
+	if s.down {
+		return s.m.DownNoTx
+	}
+	return s.m.NoTx
+}
+
+// planner picks the steps to run from the files and the applied history.
+type planner func(migs []Migration, applied map[int64]appliedMigration) ([]step, error)
+
+// RunMigrations applies every pending migration. It is what the service
+// runs on startup.
+func RunMigrations(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, opts MigrateOptions) error {
+	return MigrateUp(ctx, pool, fsys, opts, 0)
+}
+
+// MigrateUp applies the next n pending migrations in version order; n <= 0
+// applies all of them.
+func MigrateUp(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, opts MigrateOptions, n int) error {
+	return migrate(ctx, pool, fsys, opts, func(migs []Migration, applied map[int64]appliedMigration) ([]step, error) {
+		return planUp(migs, applied, n, math.MaxInt64), nil
+	})
+}
+
+// MigrateDown reverts the n most recently applied migrations; n <= 0
+// reverts one.
+func MigrateDown(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, opts MigrateOptions, n int) error {
+	return migrate(ctx, pool, fsys, opts, downPlanner(n))
+}
+
+// downPlanner plans reverting the n most recently applied migrations, or
+// all of them when fewer are applied; n <= 0 reverts one.
+func downPlanner(n int) planner {
+	if n <= 0 {
+		n = 1
+	}
+	return func(migs []Migration, applied map[int64]appliedMigration) ([]step, error) {
+		versions := appliedDesc(applied)
+		var target int64
+		if n < len(versions) {
+			target = versions[n]
+		}
+		return planDown(migs, applied, target)
+	}
+}
+
+// MigrateTo moves the schema to exactly version: applied migrations above
+// it are reverted, newest first, then pending ones up to it are applied.
+// version 0 reverts everything.
+func MigrateTo(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, opts MigrateOptions, version int64) error {
+	if version < 0 {
+		return fmt.Errorf("invalid target version %d", version)
+	}
+	return migrate(ctx, pool, fsys, opts, toPlanner(version))
+}
+
+// toPlanner plans moving the schema to exactly version; see MigrateTo.
+func toPlanner(version int64) planner {
+	return func(migs []Migration, applied map[int64]appliedMigration) ([]step, error) {
+		if version != 0 && !hasVersion(migs, version) {
+			return nil, fmt.Errorf("unknown migration version %d", version)
+		}
+		steps, err := planDown(migs, applied, version)
+		if err != nil {
+			return nil, err
+		}
+		return append(steps, planUp(migs, applied, 0, version)...), nil
+	}
+}
+
+func migrate(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, opts MigrateOptions, plan planner) error {
+	migs, err := loadMigrations(fsys)
 	if err != nil {
 		return fmt.Errorf("load migrations: %w", err)
 	}
@@ -36,54 +186,435 @@ func RunMigrations(ctx context.Context, pool *pgxpool.Pool, dir string) error {
 		return nil
 	}
 
-	lockID := advisoryLockID("demo_service_migrations")
-	if _, err := pool.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
-		return fmt.Errorf("advisory lock: %w", err)
+	// a dry run only reads, so it neither takes the lock nor touches the
+	// schema_migrations DDL and cannot wait for or block a running migration
+	if opts.DryRun != nil {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("acquire conn: %w", err)
+		}
+		defer conn.Release()
+
+		applied, err := readAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkDirty(applied); err != nil {
+			return err
+		}
+		steps, err := planSteps(migs, applied, opts, plan)
+		if err != nil {
+			return err
+		}
+		return printSteps(opts.DryRun, steps)
 	}
-	defer func() { _, _ = pool.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID) }()
 
-	if err := ensureMigrationsTable(ctx, pool); err != nil {
-		return err
+	bounded := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		bounded, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
 	}
 
-	applied, err := appliedVersions(ctx, pool)
-	if err != nil {
+	return withMigrationLock(bounded, pool, opts.LockTimeout, func(conn *pgxpool.Conn) error {
+		if err := ensureMigrationsTable(bounded, conn); err != nil {
+			return err
+		}
+
+		applied, err := appliedMigrations(bounded, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkDirty(applied); err != nil {
+			return err
+		}
+		if err := backfillChecksums(bounded, conn, migs, applied); err != nil {
+			return err
+		}
+
+		steps, err := planSteps(migs, applied, opts, plan)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range steps {
+			switch {
+			case s.noTx():
+				err = applyNoTx(ctx, conn, s)
+			case s.down:
+				err = applyDown(bounded, conn, s.m)
+			default:
+				err = applyUp(bounded, conn, s.m)
+			}
+			if err != nil {
+				return err
+			}
+			log.Printf("[migrations] %s v=%d %s", direction(s), s.m.Version, s.file())
+		}
+		return nil
+	})
+}
+
+// planSteps checks the applied history for drift, then plans the steps
+// to run.
+func planSteps(migs []Migration, applied map[int64]appliedMigration, opts MigrateOptions, plan planner) ([]step, error) {
+	if problems := detectDrift(migs, applied); len(problems) > 0 {
+		if opts.OnDrift != DriftWarn {
+			return nil, &DriftError{Problems: problems}
+		}
+		for _, p := range problems {
+			log.Printf("[migrations] drift: %s", p)
+		}
+	}
+	return plan(migs, applied)
+}
+
+func printSteps(w io.Writer, steps []step) error {
+	if len(steps) == 0 {
+		_, err := fmt.Fprintln(w, "-- nothing to do")
 		return err
 	}
+	for _, s := range steps {
+		mode, body := "", strings.TrimRight(s.sql(), "\n")
+		switch {
+		case s.fn() != nil:
+			mode, body = " (go function)", "-- no SQL to show"
+		case s.noTx():
+			mode = " (no transaction)"
+		}
+		if _, err := fmt.Fprintf(w, "-- %s v=%d %s%s\n%s\n", direction(s), s.m.Version, s.file(), mode, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func direction(s step) string {
+	if s.down {
+		return "down"
+	}
+	return "up"
+}
 
+// planUp returns pending migrations with version <= max in ascending
+// order, at most n of them when n > 0.
+func planUp(migs []Migration, applied map[int64]appliedMigration, n int, max int64) []step {
+	var steps []step
 	for _, m := range migs {
-		if applied[m.Version] {
+		if m.Version > max {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
 			continue
 		}
+		steps = append(steps, step{m: m})
+		if n > 0 && len(steps) == n {
+			break
+		}
+	}
+	return steps
+}
 
-		tx, err := pool.BeginTx(ctx, pgx.TxOptions{})
-		if err != nil {
-			return fmt.Errorf("begin tx (v=%d): %w", m.Version, err)
+func appliedDesc(applied map[int64]appliedMigration) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	return versions
+}
+
+func hasVersion(migs []Migration, v int64) bool {
+	for _, m := range migs {
+		if m.Version == v {
+			return true
+		}
+	}
+	return false
+}
+
+// DriftError lists every mismatch between schema_migrations and the files.
+type DriftError struct {
+	Problems []string
+}
+
+func (e *DriftError) Error() string {
+	return "migration drift detected: " + strings.Join(e.Problems, "; ")
+}
+
+// detectDrift compares the applied history against the loaded files:
+// applied migrations whose file changed or disappeared, and pending
+// migrations that sort before the newest applied version (typically a
+// branch merged after a later migration already ran).
+func detectDrift(migs []Migration, applied map[int64]appliedMigration) []string {
+	var problems []string
+
+	files := make(map[int64]Migration, len(migs))
+	for _, m := range migs {
+		files[m.Version] = m
+	}
+
+	var maxApplied int64
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+		if v > maxApplied {
+			maxApplied = v
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for _, v := range versions {
+		a := applied[v]
+		m, ok := files[v]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("v=%d (%s) is applied but its file is missing", v, a.Name))
+		case a.Checksum != "" && a.Checksum != m.Checksum:
+			problems = append(problems, fmt.Sprintf("v=%d (%s) was modified after being applied (checksum %s, file %s)",
+				v, m.Name, shortSum(a.Checksum), shortSum(m.Checksum)))
+		}
+	}
+
+	for _, m := range migs {
+		if _, ok := applied[m.Version]; !ok && m.Version < maxApplied {
+			problems = append(problems, fmt.Sprintf("v=%d (%s) is pending but v=%d is already applied", m.Version, m.Name, maxApplied))
+		}
+	}
+
+	return problems
+}
+
+// backfillChecksums records the current file checksum for rows applied
+// before checksums were tracked, trusting the files as they are now.
+func backfillChecksums(ctx context.Context, conn *pgxpool.Conn, migs []Migration, applied map[int64]appliedMigration) error {
+	for _, m := range migs {
+		a, ok := applied[m.Version]
+		if !ok || a.Checksum != "" {
+			continue
 		}
+		if _, err := conn.Exec(ctx, `
+			UPDATE schema_migrations SET checksum = $2 WHERE version = $1 AND checksum IS NULL
+		`, m.Version, m.Checksum); err != nil {
+			return fmt.Errorf("backfill checksum (v=%d): %w", m.Version, err)
+		}
+		a.Checksum = m.Checksum
+		applied[m.Version] = a
+		log.Printf("[migrations] recorded checksum for previously applied v=%d (%s)", m.Version, m.Name)
+	}
+	return nil
+}
 
-		if _, err := tx.Exec(ctx, m.SQL); err != nil {
-			_ = tx.Rollback(ctx)
-			return fmt.Errorf("exec migration (v=%d, %s): %w", m.Version, m.Name, err)
+func checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+func shortSum(s string) string {
+	if len(s) > 12 {
+		return s[:12]
+	}
+	return s
+}
+
+// planDown returns the migrations to revert to reach target, newest first.
+// Every one of them must have a down file; this is checked before anything
+// runs, so a missing file never leaves the schema half rolled back.
+func planDown(migs []Migration, applied map[int64]appliedMigration, target int64) ([]step, error) {
+	byVersion := make(map[int64]Migration, len(migs))
+	for _, m := range migs {
+		byVersion[m.Version] = m
+	}
+
+	var (
+		steps   []step
+		missing []string
+	)
+	for _, v := range appliedDesc(applied) {
+		if v <= target {
+			break
 		}
+		m, ok := byVersion[v]
+		switch {
+		case !ok:
+			missing = append(missing, fmt.Sprintf("v=%d (no migration files)", v))
+		case !m.HasDown():
+			missing = append(missing, fmt.Sprintf("v=%d (%s has no down migration)", v, m.Name))
+		default:
+			steps = append(steps, step{m: m, down: true})
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("cannot roll back to v=%d: %s", target, strings.Join(missing, ", "))
+	}
+	return steps, nil
+}
+
+func applyUp(ctx context.Context, conn *pgxpool.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin tx (v=%d): %w", m.Version, err)
+	}
+
+	if m.UpFunc != nil {
+		err = m.UpFunc(ctx, tx)
+	} else {
+		_, err = tx.Exec(ctx, m.SQL)
+	}
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("exec migration (v=%d, %s): %w", m.Version, m.Name, err)
+	}
 
-		if _, err := tx.Exec(ctx, `
-			INSERT INTO schema_migrations (version, name, applied_at)
-			VALUES ($1, $2, now())
-		`, m.Version, m.Name); err != nil {
-			_ = tx.Rollback(ctx)
-			return fmt.Errorf("record migration (v=%d): %w", m.Version, err)
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO schema_migrations (version, name, applied_at, checksum)
+		VALUES ($1, $2, now(), $3)
+	`, m.Version, m.Name, m.Checksum); err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("record migration (v=%d): %w", m.Version, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit migration (v=%d): %w", m.Version, err)
+	}
+	return nil
+}
+
+func applyDown(ctx context.Context, conn *pgxpool.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin tx (v=%d): %w", m.Version, err)
+	}
+
+	if m.DownFunc != nil {
+		err = m.DownFunc(ctx, tx)
+	} else {
+		_, err = tx.Exec(ctx, m.DownSQL)
+	}
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("exec down migration (v=%d, %s): %w", m.Version, m.DownName, err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version); err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("unrecord migration (v=%d): %w", m.Version, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit down migration (v=%d): %w", m.Version, err)
+	}
+	return nil
+}
+
+// applyNoTx runs a migration marked no-transaction statement by statement.
+// Because a failure can leave the schema partly changed, the
+// schema_migrations row is written first with dirty=true and only cleared
+// (or, going down, deleted) once every statement succeeded. A dirty row
+// blocks further migrations until an operator inspects the schema and runs
+// Resolve. The statements run with statement_timeout disabled, so a
+// pool-wide timeout does not abort an index build halfway. If cancelling
+// ctx closed the connection, the failure text is not recorded, but the row
+// stays dirty.
+func applyNoTx(ctx context.Context, conn *pgxpool.Conn, s step) error {
+	m := s.m
+
+	if s.down {
+		_, err := conn.Exec(ctx, `UPDATE schema_migrations SET dirty = true, error = NULL WHERE version = $1`, m.Version)
+		if err != nil {
+			return fmt.Errorf("mark migration dirty (v=%d): %w", m.Version, err)
 		}
+	} else {
+		_, err := conn.Exec(ctx, `
+			INSERT INTO schema_migrations (version, name, applied_at, checksum, dirty)
+			VALUES ($1, $2, now(), $3, true)
+		`, m.Version, m.Name, m.Checksum)
+		if err != nil {
+			return fmt.Errorf("mark migration dirty (v=%d): %w", m.Version, err)
+		}
+	}
+
+	if _, err := conn.Exec(ctx, `SET statement_timeout = 0`); err != nil {
+		return fmt.Errorf("disable statement timeout (v=%d): %w", m.Version, err)
+	}
+	defer func() { _, _ = conn.Exec(context.Background(), `RESET statement_timeout`) }()
 
-		if err := tx.Commit(ctx); err != nil {
-			return fmt.Errorf("commit migration (v=%d): %w", m.Version, err)
+	stmts := splitStatements(s.sql())
+	for i, stmt := range stmts {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			msg := fmt.Sprintf("statement %d/%d: %v", i+1, len(stmts), err)
+			_, _ = conn.Exec(context.Background(), `UPDATE schema_migrations SET error = $2 WHERE version = $1`, m.Version, msg)
+			return fmt.Errorf("exec non-transactional migration (v=%d, %s) %s; v=%d is marked dirty",
+				m.Version, s.file(), msg, m.Version)
 		}
 	}
 
+	var err error
+	if s.down {
+		_, err = conn.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	} else {
+		_, err = conn.Exec(ctx, `UPDATE schema_migrations SET dirty = false, applied_at = now() WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("record migration (v=%d): %w", m.Version, err)
+	}
 	return nil
 }
 
-func ensureMigrationsTable(ctx context.Context, pool *pgxpool.Pool) error {
-	_, err := pool.Exec(ctx, `
+// DirtyError reports migrations left half-applied by a failed
+// non-transactional run.
+type DirtyError struct {
+	Migrations []string
+}
+
+func (e *DirtyError) Error() string {
+	return "dirty migrations, fix the schema by hand and then run `migrate resolve V applied|pending`: " +
+		strings.Join(e.Migrations, "; ")
+}
+
+func checkDirty(applied map[int64]appliedMigration) error {
+	var dirty []string
+	for _, v := range appliedDesc(applied) {
+		if a := applied[v]; a.Dirty {
+			dirty = append(dirty, fmt.Sprintf("v=%d (%s): %s", v, a.Name, a.Error))
+		}
+	}
+	if len(dirty) > 0 {
+		return &DirtyError{Migrations: dirty}
+	}
+	return nil
+}
+
+// Resolve clears the dirty flag on version after a failed non-transactional
+// migration was repaired by hand. applied=true keeps it recorded as applied;
+// applied=false forgets it so the next run retries it.
+func Resolve(ctx context.Context, pool *pgxpool.Pool, version int64, applied bool) error {
+	return withMigrationLock(ctx, pool, 0, func(conn *pgxpool.Conn) error {
+		if err := ensureMigrationsTable(ctx, conn); err != nil {
+			return err
+		}
+
+		var (
+			tag pgconn.CommandTag
+			err error
+		)
+		if applied {
+			tag, err = conn.Exec(ctx, `UPDATE schema_migrations SET dirty = false, error = NULL WHERE version = $1 AND dirty`, version)
+		} else {
+			tag, err = conn.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1 AND dirty`, version)
+		}
+		if err != nil {
+			return fmt.Errorf("resolve migration (v=%d): %w", version, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("migration v=%d is not dirty", version)
+		}
+		return nil
+	})
+}
+
+func ensureMigrationsTable(ctx context.Context, conn *pgxpool.Conn) error {
+	_, err := conn.Exec(ctx, `
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			version    BIGINT PRIMARY KEY,
 			name       TEXT NOT NULL,
@@ -93,26 +624,100 @@ func ensureMigrationsTable(ctx context.Context, pool *pgxpool.Pool) error {
 	if err != nil {
 		return fmt.Errorf("create schema_migrations: %w", err)
 	}
+
+	// checksum is NULL for rows applied before checksums were tracked;
+	// dirty/error track non-transactional migrations that failed halfway
+	_, err = conn.Exec(ctx, `
+		ALTER TABLE schema_migrations
+			ADD COLUMN IF NOT EXISTS checksum TEXT,
+			ADD COLUMN IF NOT EXISTS dirty    BOOLEAN NOT NULL DEFAULT false,
+			ADD COLUMN IF NOT EXISTS error    TEXT
+	`)
+	if err != nil {
+		return fmt.Errorf("extend schema_migrations: %w", err)
+	}
 	return nil
 }
 
-func appliedVersions(ctx context.Context, pool *pgxpool.Pool) (map[int64]bool, error) {
+type appliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+	Dirty     bool
+	Error     string
+}
+
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) (map[int64]appliedMigration, error) {
+	return queryApplied(ctx, conn, `
+		SELECT version, name, COALESCE(checksum, ''), applied_at, dirty, COALESCE(error, '')
+		FROM schema_migrations
+	`)
+}
+
+// readAppliedMigrations is appliedMigrations for read-only callers: it
+// does not create or extend schema_migrations, whose ALTER TABLE takes an
+// ACCESS EXCLUSIVE lock even when it changes nothing, but reads whatever
+// columns an older version of the table has.
+func readAppliedMigrations(ctx context.Context, conn *pgxpool.Conn) (map[int64]appliedMigration, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("probe schema_migrations: %w", err)
+	}
+	if !exists {
+		return map[int64]appliedMigration{}, nil
+	}
+
+	rows, err := conn.Query(ctx, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'schema_migrations'
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("probe schema_migrations columns: %w", err)
+	}
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan column: %w", err)
+		}
+		cols[c] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows err: %w", err)
+	}
+
+	column := func(name, missing string) string {
+		if cols[name] {
+			return name
+		}
+		return missing
+	}
+	return queryApplied(ctx, conn, fmt.Sprintf(`
+		SELECT version, name, COALESCE(%s, ''), applied_at, %s, COALESCE(%s, '')
+		FROM schema_migrations
+	`, column("checksum", "NULL"), column("dirty", "false"), column("error", "NULL")))
+}
+
+func queryApplied(ctx context.Context, conn *pgxpool.Conn, query string) (map[int64]appliedMigration, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	rows, err := pool.Query(ctx, `SELECT version FROM schema_migrations`)
+	rows, err := conn.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("query schema_migrations: %w", err)
 	}
 	defer rows.Close()
 
-	out := make(map[int64]bool)
+	out := make(map[int64]appliedMigration)
 	for rows.Next() {
-		var v int64
-		if err := rows.Scan(&v); err != nil {
+		var a appliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt, &a.Dirty, &a.Error); err != nil {
 			return nil, fmt.Errorf("scan version: %w", err)
 		}
-		out[v] = true
+		out[a.Version] = a
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("rows err: %w", err)
@@ -120,58 +725,73 @@ func appliedVersions(ctx context.Context, pool *pgxpool.Pool) (map[int64]bool, e
 	return out, nil
 }
 
-func loadMigrations(dir string) ([]Migration, error) {
-	entries, err := os.ReadDir(dir)
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := migrations.ReadFiles(fsys)
 	if err != nil {
-		return nil, fmt.Errorf("readdir %s: %w", dir, err)
+		return nil, err
 	}
 
-	var migs []Migration
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		name := e.Name()
-		if !strings.HasSuffix(name, ".up.sql") {
-			continue
+	byVersion := make(map[int64]*Migration)
+	get := func(v int64) *Migration {
+		m, ok := byVersion[v]
+		if !ok {
+			m = &Migration{Version: v}
+			byVersion[v] = m
 		}
+		return m
+	}
 
-		version, ok := parseVersion(name)
-		if !ok {
-			return nil, fmt.Errorf("invalid migration filename: %s (expected like 0001_name.up.sql)", name)
+	for _, f := range files {
+		m := get(f.Version)
+		if f.Up {
+			if m.Name != "" {
+				return nil, fmt.Errorf("duplicate up migration v=%d: %s and %s", f.Version, m.Name, f.Name)
+			}
+			m.Name, m.SQL, m.Checksum, m.NoTx = f.Name, f.SQL, checksum(f.SQL), hasNoTxDirective(f.SQL)
+		} else {
+			if m.DownName != "" {
+				return nil, fmt.Errorf("duplicate down migration v=%d: %s and %s", f.Version, m.DownName, f.Name)
+			}
+			m.DownName, m.DownSQL, m.DownNoTx = f.Name, f.SQL, hasNoTxDirective(f.SQL)
 		}
+	}
 
-		path := filepath.Join(dir, name)
-		b, err := os.ReadFile(path)
-		if err != nil {
-			return nil, fmt.Errorf("read %s: %w", path, err)
+	migs := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Name == "" {
+			return nil, fmt.Errorf("down migration %s has no matching .up.sql", m.DownName)
+		}
+		if m.HasDown() && strings.TrimSuffix(m.DownName, ".down.sql") != strings.TrimSuffix(m.Name, ".up.sql") {
+			return nil, fmt.Errorf("migration names differ for v=%d: %s vs %s", m.Version, m.Name, m.DownName)
 		}
+		migs = append(migs, *m)
+	}
 
-		migs = append(migs, Migration{
-			Version: version,
-			Path:    path,
-			Name:    name,
-			SQL:     string(b),
-		})
+	for _, g := range registeredGoMigrations() {
+		if m, ok := byVersion[g.Version]; ok {
+			return nil, fmt.Errorf("go migration v=%d (%s) clashes with %s", g.Version, g.Name, m.Name)
+		}
+		migs = append(migs, g.migration())
 	}
 
 	sort.Slice(migs, func(i, j int) bool { return migs[i].Version < migs[j].Version })
 	return migs, nil
 }
 
-func parseVersion(filename string) (int64, bool) {
-	parts := strings.SplitN(filename, "_", 2)
-	if len(parts) < 2 {
-		return 0, false
-	}
-	v, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return 0, false
+// hasNoTxDirective looks for the no-transaction directive in the comment
+// lines at the top of a migration file.
+func hasNoTxDirective(sql string) bool {
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			return false
+		}
+		if strings.ReplaceAll(strings.TrimPrefix(line, "--"), " ", "") == noTxDirective {
+			return true
+		}
 	}
-	return v, true
-}
-
-func advisoryLockID(key string) int64 {
-	sum := sha1.Sum([]byte(key))
-	return int64(binary.BigEndian.Uint64(sum[:8]))
+	return false
 }
@@ -0,0 +1,105 @@
+package postgres_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"demo_service/internal/adapters/outbound/postgres"
+)
+
+func TestDryRunRecordsNothing(t *testing.T) {
+	db := newSchema(t, postgres.PoolConfig{})
+	fsys := fstest.MapFS{
+		"0001_widgets.up.sql": &fstest.MapFile{Data: []byte("CREATE TABLE widgets (id int);\n")},
+	}
+
+	var buf bytes.Buffer
+	if err := postgres.RunMigrations(t.Context(), db.Pool, fsys, postgres.MigrateOptions{DryRun: &buf}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "-- up v=1 0001_widgets.up.sql\nCREATE TABLE widgets (id int);") {
+		t.Fatalf("dry run output = %q", buf.String())
+	}
+
+	for _, table := range []string{"schema_migrations", "widgets"} {
+		var exists bool
+		if err := db.Pool.QueryRow(t.Context(), `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Errorf("dry run created %s", table)
+		}
+	}
+
+	st, err := postgres.Status(t.Context(), db.Pool, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st) != 1 || st[0].State != postgres.StatePending {
+		t.Fatalf("status after dry run = %+v", st)
+	}
+}
+
+func TestMigrateWithOneConnection(t *testing.T) {
+	db := newSchema(t, postgres.PoolConfig{MaxConns: 1})
+	fsys := fstest.MapFS{
+		"0001_widgets.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE widgets (id int);\n")},
+		"0001_widgets.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE widgets;\n")},
+		"0002_index.up.sql": &fstest.MapFile{Data: []byte(
+			"-- migrate:no-transaction\nCREATE INDEX CONCURRENTLY widgets_id ON widgets (id);\n")},
+		"0002_index.down.sql": &fstest.MapFile{Data: []byte(
+			"-- migrate:no-transaction\nDROP INDEX CONCURRENTLY widgets_id;\n")},
+	}
+	opts := postgres.MigrateOptions{LockTimeout: 5 * time.Second}
+
+	if err := postgres.RunMigrations(t.Context(), db.Pool, fsys, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := postgres.MigrateTo(t.Context(), db.Pool, fsys, opts, 0); err != nil {
+		t.Fatal(err)
+	}
+	st, err := postgres.Status(t.Context(), db.Pool, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range st {
+		if s.State != postgres.StatePending {
+			t.Errorf("v=%d is %s after migrating to 0", s.Version, s.State)
+		}
+	}
+}
+
+func TestMigrateLockTimeout(t *testing.T) {
+	db := newSchema(t, postgres.PoolConfig{MaxConns: 2})
+	holder, err := db.Pool.Acquire(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Release()
+	if _, err := holder.Exec(t.Context(), `SELECT pg_advisory_lock($1)`, postgres.MigrationLockID); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = holder.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, postgres.MigrationLockID)
+	}()
+
+	fsys := fstest.MapFS{"0001_widgets.up.sql": &fstest.MapFile{Data: []byte("CREATE TABLE widgets (id int);\n")}}
+	start := time.Now()
+	err = postgres.RunMigrations(t.Context(), db.Pool, fsys, postgres.MigrateOptions{LockTimeout: time.Second})
+
+	var lte *postgres.LockTimeoutError
+	if !errors.As(err, &lte) {
+		t.Fatalf("err = %v, want a LockTimeoutError", err)
+	}
+	if !strings.HasPrefix(lte.Holder, "pid ") {
+		t.Errorf("holder = %q, want the holding session described", lte.Holder)
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Errorf("gave up after %s, want about 1s", waited)
+	}
+}
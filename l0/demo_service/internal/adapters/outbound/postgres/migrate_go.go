@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GoMigrationFunc runs inside the migration's transaction; returning an
+// error rolls the whole step back.
+type GoMigrationFunc func(ctx context.Context, tx pgx.Tx) error
+
+// GoMigration is a migration written in Go, for data transformations that
+// are awkward in plain SQL. It shares the version space with the SQL files
+// and is applied by the same runner, under the same advisory lock, and
+// recorded in schema_migrations like any other migration.
+type GoMigration struct {
+	Version int64
+	Name    string
+	Up      GoMigrationFunc
+	Down    GoMigrationFunc // optional; without it the version cannot be rolled back
+}
+
+var (
+	goMigrationsMu sync.Mutex
+	goMigrations   = make(map[int64]GoMigration)
+)
+
+// RegisterGoMigration makes m known to every later run. It is meant to be
+// called from init functions next to the SQL files and panics on invalid
+// or duplicate registrations, like database/sql.Register.
+//
+// Drift detection only sees the version and name of a Go migration, not
+// its code: editing Up after it ran goes unnoticed. Ship a changed data
+// transformation as a new migration instead.
+func RegisterGoMigration(m GoMigration) {
+	if m.Version <= 0 || m.Name == "" || m.Up == nil {
+		panic(fmt.Sprintf("postgres: invalid go migration v=%d %q", m.Version, m.Name))
+	}
+
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+	if prev, ok := goMigrations[m.Version]; ok {
+		panic(fmt.Sprintf("postgres: go migration v=%d registered twice (%s, %s)", m.Version, prev.Name, m.Name))
+	}
+	goMigrations[m.Version] = m
+}
+
+func registeredGoMigrations() []GoMigration {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	out := make([]GoMigration, 0, len(goMigrations))
+	for _, m := range goMigrations {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out
+}
+
+// migration converts a registration into a runner Migration. The
+// checksum covers the name only: code changes cannot be detected, but a
+// renamed or swapped version still shows up as drift.
+func (g GoMigration) migration() Migration {
+	name := fmt.Sprintf("%04d_%s.go", g.Version, g.Name)
+	m := Migration{
+		Version:  g.Version,
+		Name:     name,
+		Checksum: checksum("go:" + name),
+		UpFunc:   g.Up,
+	}
+	if g.Down != nil {
+		m.DownName = name
+		m.DownFunc = g.Down
+	}
+	return m
+}
@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	lockPollInterval = 500 * time.Millisecond
+	lockLogInterval  = 5 * time.Second
+
+	migrationLockKey = "demo_service_migrations"
+)
+
+// withMigrationLock runs fn while holding the migrations advisory lock.
+// Session-level advisory locks belong to a connection, so the lock and
+// unlock go through one dedicated connection rather than the pool. fn gets
+// that connection and runs everything on it: taking a second one from the
+// pool while holding the first would hang with DB_MAX_CONNS=1.
+//
+// The lock is polled with pg_try_advisory_lock instead of blocking in
+// pg_advisory_lock, so a replica stuck mid-migration is reported (who holds
+// the lock, since when, doing what) every few seconds and the wait fails
+// with a LockTimeoutError after timeout instead of stalling silently.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire lock conn: %w", err)
+	}
+	defer conn.Release()
+
+	lockID := advisoryLockID(migrationLockKey)
+	if err := acquireLock(ctx, conn, lockID, timeout); err != nil {
+		return err
+	}
+	defer func() { _, _ = conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID) }()
+
+	return fn(conn)
+}
+
+func acquireLock(ctx context.Context, conn *pgxpool.Conn, lockID int64, timeout time.Duration) error {
+	start := time.Now()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		deadline = t.C
+	}
+
+	poll := time.NewTicker(lockPollInterval)
+	defer poll.Stop()
+
+	var lastLog time.Time
+	for {
+		var ok bool
+		if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, lockID).Scan(&ok); err != nil {
+			return fmt.Errorf("advisory lock: %w", err)
+		}
+		if ok {
+			if !lastLog.IsZero() {
+				log.Printf("[migrations] lock acquired after %s", time.Since(start).Round(time.Millisecond))
+			}
+			return nil
+		}
+
+		if time.Since(lastLog) >= lockLogInterval {
+			log.Printf("[migrations] waiting for lock held by %s (waited %s)",
+				describeHolder(conn, lockID), time.Since(start).Round(time.Second))
+			lastLog = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for migration lock held by %s: %w", describeHolder(conn, lockID), ctx.Err())
+		case <-deadline:
+			return &LockTimeoutError{Waited: time.Since(start), Holder: describeHolder(conn, lockID)}
+		case <-poll.C:
+		}
+	}
+}
+
+// LockTimeoutError is returned when another session kept the migrations
+// lock for longer than MigrateOptions.LockTimeout.
+type LockTimeoutError struct {
+	Waited time.Duration
+	Holder string
+}
+
+func (e *LockTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for migration lock held by %s",
+		e.Waited.Round(time.Second), e.Holder)
+}
+
+// describeHolder looks up the session holding the advisory lock in
+// pg_locks/pg_stat_activity. It uses its own short timeout so it still works
+// once ctx is done, and degrades to "unknown session" on any error.
+func describeHolder(conn *pgxpool.Conn, lockID int64) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// a bigint advisory key is stored as classid (high 32 bits) and objid
+	// (low 32 bits) with objsubid = 1
+	classID := int64(uint64(lockID) >> 32)
+	objID := int64(uint32(lockID))
+
+	var (
+		pid                   int32
+		app, addr, state, qry string
+		since                 *time.Time
+	)
+	err := conn.QueryRow(ctx, `
+		SELECT l.pid,
+			COALESCE(a.application_name, ''),
+			COALESCE(host(a.client_addr), 'local'),
+			COALESCE(a.state, ''),
+			COALESCE(a.xact_start, a.backend_start),
+			COALESCE(a.query, '')
+		FROM pg_locks l
+		LEFT JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.granted
+		  AND l.classid::bigint = $1 AND l.objid::bigint = $2 AND l.objsubid = 1
+		LIMIT 1
+	`, classID, objID).Scan(&pid, &app, &addr, &state, &since, &qry)
+	if err != nil {
+		return "unknown session"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "pid %d (app=%q, client=%s", pid, app, addr)
+	if state != "" {
+		fmt.Fprintf(&b, ", state=%s", state)
+	}
+	if since != nil {
+		fmt.Fprintf(&b, ", since %s", since.Format(time.RFC3339))
+	}
+	if qry = strings.Join(strings.Fields(qry), " "); qry != "" {
+		if len(qry) > 80 {
+			qry = qry[:80] + "..."
+		}
+		fmt.Fprintf(&b, ", last query %q", qry)
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+func advisoryLockID(key string) int64 {
+	sum := sha1.Sum([]byte(key))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}
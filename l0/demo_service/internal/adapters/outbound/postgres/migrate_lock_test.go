@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockTimeoutError(t *testing.T) {
+	err := &LockTimeoutError{Waited: 20*time.Second + 300*time.Millisecond, Holder: `pid 42 (app="demo", client=local)`}
+	want := `timed out after 20s waiting for migration lock held by pid 42 (app="demo", client=local)`
+	if err.Error() != want {
+		t.Fatalf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestAdvisoryLockID(t *testing.T) {
+	if advisoryLockID(migrationLockKey) != advisoryLockID(migrationLockKey) {
+		t.Fatal("lock id is not stable")
+	}
+	if advisoryLockID(migrationLockKey) == advisoryLockID("other") {
+		t.Fatal("different keys share a lock id")
+	}
+}
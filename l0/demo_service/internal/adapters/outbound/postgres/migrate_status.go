@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	StateApplied    = "applied"
+	StatePending    = "pending"
+	StateModified   = "modified"
+	StateMissing    = "missing file"
+	StateOutOfOrder = "out of order"
+	StateDirty      = "dirty"
+)
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt time.Time // zero while pending
+	State     string
+	Error     string // last failure of a dirty non-transactional migration
+}
+
+// Status reports every known migration, from the files and from
+// schema_migrations, in version order. It only reads: it takes neither the
+// migration lock nor any table lock, so it can be used while another
+// instance is migrating and never holds that migration up.
+func Status(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS) ([]MigrationStatus, error) {
+	migs, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("load migrations: %w", err)
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire conn: %w", err)
+	}
+	defer conn.Release()
+
+	applied, err := readAppliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var maxApplied int64
+	for v := range applied {
+		if v > maxApplied {
+			maxApplied = v
+		}
+	}
+
+	seen := make(map[int64]bool, len(migs))
+	out := make([]MigrationStatus, 0, len(migs)+len(applied))
+	for _, m := range migs {
+		seen[m.Version] = true
+		st := MigrationStatus{Version: m.Version, Name: m.Name, State: StatePending}
+		if a, ok := applied[m.Version]; ok {
+			st.AppliedAt = a.AppliedAt
+			st.State = StateApplied
+			switch {
+			case a.Dirty:
+				st.State, st.Error = StateDirty, a.Error
+			case a.Checksum != "" && a.Checksum != m.Checksum:
+				st.State = StateModified
+			}
+		} else if m.Version < maxApplied {
+			st.State = StateOutOfOrder
+		}
+		out = append(out, st)
+	}
+	for v, a := range applied {
+		if !seen[v] {
+			out = append(out, MigrationStatus{Version: v, Name: a.Name, AppliedAt: a.AppliedAt, State: StateMissing})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+var migrationNameRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateMigration scaffolds an empty NNNN_name.up.sql / .down.sql pair in
+// dir, numbered one above the highest existing version. A name already
+// used by another migration is refused.
+func CreateMigration(dir, name string) (upPath, downPath string, err error) {
+	slug := strings.Trim(migrationNameRe.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if slug == "" {
+		return "", "", fmt.Errorf("invalid migration name %q", name)
+	}
+
+	migs, err := loadMigrations(os.DirFS(dir))
+	if err != nil {
+		return "", "", fmt.Errorf("load migrations: %w", err)
+	}
+	for _, m := range migs {
+		if migrationSlug(m.Name) == slug {
+			return "", "", fmt.Errorf("migration %q already exists: %s", slug, m.Name)
+		}
+	}
+	var next int64 = 1
+	if len(migs) > 0 {
+		next = migs[len(migs)-1].Version + 1
+	}
+
+	base := fmt.Sprintf("%04d_%s", next, slug)
+	upPath = filepath.Join(dir, base+".up.sql")
+	downPath = filepath.Join(dir, base+".down.sql")
+
+	if err := createFile(upPath, fmt.Sprintf("-- %s: apply\n", base)); err != nil {
+		return "", "", err
+	}
+	if err := createFile(downPath, fmt.Sprintf("-- %s: revert\n", base)); err != nil {
+		_ = os.Remove(upPath)
+		return "", "", err
+	}
+	return upPath, downPath, nil
+}
+
+// migrationSlug is the name part of NNNN_name.up.sql or NNNN_name.go.
+func migrationSlug(file string) string {
+	_, rest, _ := strings.Cut(file, "_")
+	rest = strings.TrimSuffix(rest, ".up.sql")
+	return strings.TrimSuffix(rest, ".go")
+}
+
+func createFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return f.Close()
+}
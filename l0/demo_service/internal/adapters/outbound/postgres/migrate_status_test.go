@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range migrationFS("0001_a.up.sql", "0001_a.down.sql", "0007_b.up.sql") {
+		if err := os.WriteFile(filepath.Join(dir, name), body.Data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	up, down, err := CreateMigration(dir, "Add Orders Index!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0008_add_orders_index.up.sql" || filepath.Base(down) != "0008_add_orders_index.down.sql" {
+		t.Fatalf("created %s and %s", up, down)
+	}
+	b, err := os.ReadFile(up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "-- 0008_add_orders_index: apply\n" {
+		t.Errorf("up file = %q", b)
+	}
+	if _, err := loadMigrations(os.DirFS(dir)); err != nil {
+		t.Fatalf("scaffolded files do not load: %v", err)
+	}
+}
+
+func TestCreateMigrationFirst(t *testing.T) {
+	up, _, err := CreateMigration(t.TempDir(), "init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0001_init.up.sql" {
+		t.Fatalf("created %s", up)
+	}
+}
+
+func TestCreateMigrationRejects(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "0001_add_orders.up.sql"), []byte("SELECT 1;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, arg, want string
+	}{
+		{"existing name", "add orders", `migration "add_orders" already exists: 0001_add_orders.up.sql`},
+		{"empty", "", "invalid migration name"},
+		{"no letters or digits", " -/_ ", "invalid migration name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := CreateMigration(dir, tt.arg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("rejected names left %d files behind", len(entries))
+	}
+}
@@ -0,0 +1,359 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func migrationFS(names ...string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, n := range names {
+		fsys[n] = &fstest.MapFile{Data: []byte("-- " + n + "\nSELECT 1;\n")}
+	}
+	return fsys
+}
+
+// testMigrations loads 0001..0003 with down files, and 0004 without one.
+func testMigrations(t *testing.T) []Migration {
+	t.Helper()
+	migs, err := loadMigrations(migrationFS(
+		"0001_a.up.sql", "0001_a.down.sql",
+		"0002_b.up.sql", "0002_b.down.sql",
+		"0003_c.up.sql", "0003_c.down.sql",
+		"0004_d.up.sql",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migs
+}
+
+func appliedUpTo(migs []Migration, max int64) map[int64]appliedMigration {
+	applied := make(map[int64]appliedMigration)
+	for _, m := range migs {
+		if m.Version <= max {
+			applied[m.Version] = appliedMigration{Version: m.Version, Name: m.Name, Checksum: m.Checksum}
+		}
+	}
+	return applied
+}
+
+// plan renders steps as "up 0001_a.up.sql", "down 0003_c.down.sql", ...
+func plan(steps []step) []string {
+	out := make([]string, 0, len(steps))
+	for _, s := range steps {
+		out = append(out, direction(s)+" "+s.file())
+	}
+	return out
+}
+
+func TestLoadMigrationsPairs(t *testing.T) {
+	migs := testMigrations(t)
+
+	if len(migs) != 4 {
+		t.Fatalf("got %d migrations, want 4", len(migs))
+	}
+	for i, m := range migs {
+		if m.Version != int64(i+1) {
+			t.Errorf("migs[%d].Version = %d, want %d", i, m.Version, i+1)
+		}
+		if m.Checksum != checksum(m.SQL) {
+			t.Errorf("v=%d checksum does not cover its up SQL", m.Version)
+		}
+	}
+	if m := migs[0]; m.DownName != "0001_a.down.sql" || !strings.Contains(m.DownSQL, "0001_a.down.sql") {
+		t.Errorf("v=1 down = %q %q", m.DownName, m.DownSQL)
+	}
+	if migs[3].HasDown() {
+		t.Errorf("v=4 has a down migration: %q", migs[3].DownName)
+	}
+}
+
+func TestLoadMigrationsRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"down without up", []string{"0001_a.up.sql", "0002_b.down.sql"}, "has no matching .up.sql"},
+		{"names differ", []string{"0001_a.up.sql", "0001_b.down.sql"}, "migration names differ"},
+		{"duplicate up", []string{"0001_a.up.sql", "0001_b.up.sql"}, "duplicate up migration v=1"},
+		{"duplicate down", []string{"0001_a.up.sql", "0001_a.down.sql", "01_a.down.sql"}, "duplicate down migration v=1"},
+		{"bad name", []string{"a.up.sql"}, "invalid migration filename"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(migrationFS(tt.files...))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanUp(t *testing.T) {
+	migs := testMigrations(t)
+
+	tests := []struct {
+		name    string
+		applied int64
+		n       int
+		max     int64
+		want    []string
+	}{
+		{"all pending", 0, 0, math.MaxInt64, []string{"up 0001_a.up.sql", "up 0002_b.up.sql", "up 0003_c.up.sql", "up 0004_d.up.sql"}},
+		{"next two", 1, 2, math.MaxInt64, []string{"up 0002_b.up.sql", "up 0003_c.up.sql"}},
+		{"up to max", 0, 0, 2, []string{"up 0001_a.up.sql", "up 0002_b.up.sql"}},
+		{"nothing pending", 4, 0, math.MaxInt64, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := plan(planUp(migs, appliedUpTo(migs, tt.applied), tt.n, tt.max))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("plan = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownPlanner(t *testing.T) {
+	migs := testMigrations(t)
+
+	tests := []struct {
+		name    string
+		applied int64
+		n       int
+		want    []string
+		wantErr string
+	}{
+		{"one by default", 3, 0, []string{"down 0003_c.down.sql"}, ""},
+		{"two newest first", 3, 2, []string{"down 0003_c.down.sql", "down 0002_b.down.sql"}, ""},
+		{"past applied reverts all", 2, 5, []string{"down 0002_b.down.sql", "down 0001_a.down.sql"}, ""},
+		{"nothing applied", 0, 1, []string{}, ""},
+		{"up without down", 4, 2, nil, "v=4 (0004_d.up.sql has no down migration)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := downPlanner(tt.n)(migs, appliedUpTo(migs, tt.applied))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plan(steps); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("plan = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownPlannerMissingFiles(t *testing.T) {
+	migs := testMigrations(t)
+	applied := appliedUpTo(migs, 3)
+	applied[9] = appliedMigration{Version: 9, Name: "0009_gone.up.sql"}
+
+	_, err := downPlanner(1)(migs, applied)
+	if err == nil || !strings.Contains(err.Error(), "v=9 (no migration files)") {
+		t.Fatalf("err = %v, want the missing files reported", err)
+	}
+}
+
+func TestToPlanner(t *testing.T) {
+	migs := testMigrations(t)
+
+	tests := []struct {
+		name    string
+		applied int64
+		version int64
+		want    []string
+		wantErr string
+	}{
+		{"current version", 2, 2, []string{}, ""},
+		{"forward", 1, 3, []string{"up 0002_b.up.sql", "up 0003_c.up.sql"}, ""},
+		{"back", 3, 1, []string{"down 0003_c.down.sql", "down 0002_b.down.sql"}, ""},
+		{"zero reverts all", 2, 0, []string{"down 0002_b.down.sql", "down 0001_a.down.sql"}, ""},
+		{"unknown version", 1, 7, nil, "unknown migration version 7"},
+		{"back over up without down", 4, 3, nil, "cannot roll back to v=3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := toPlanner(tt.version)(migs, appliedUpTo(migs, tt.applied))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plan(steps); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("plan = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToPlannerBelowLowest(t *testing.T) {
+	migs, err := loadMigrations(migrationFS("0005_a.up.sql", "0005_a.down.sql", "0006_b.up.sql", "0006_b.down.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := toPlanner(3)(migs, appliedUpTo(migs, 6)); err == nil || !strings.Contains(err.Error(), "unknown migration version 3") {
+		t.Fatalf("err = %v, want unknown version", err)
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	migs := testMigrations(t)
+
+	tests := []struct {
+		name   string
+		edit   func(applied map[int64]appliedMigration)
+		wanted []string
+	}{
+		{"in sync", func(map[int64]appliedMigration) {}, nil},
+		{"checksum mismatch", func(a map[int64]appliedMigration) {
+			m := a[2]
+			m.Checksum = checksum("SELECT 2;")
+			a[2] = m
+		}, []string{"v=2 (0002_b.up.sql) was modified after being applied"}},
+		{"checksum not recorded yet", func(a map[int64]appliedMigration) {
+			m := a[2]
+			m.Checksum = ""
+			a[2] = m
+		}, nil},
+		{"missing file", func(a map[int64]appliedMigration) {
+			a[7] = appliedMigration{Version: 7, Name: "0007_gone.up.sql"}
+		}, []string{
+			"v=7 (0007_gone.up.sql) is applied but its file is missing",
+			"v=4 (0004_d.up.sql) is pending but v=7 is already applied",
+		}},
+		{"gap", func(a map[int64]appliedMigration) {
+			delete(a, 2)
+		}, []string{"v=2 (0002_b.up.sql) is pending but v=3 is already applied"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied := appliedUpTo(migs, 3)
+			tt.edit(applied)
+
+			got := detectDrift(migs, applied)
+			if len(got) != len(tt.wanted) {
+				t.Fatalf("problems = %q, want %d", got, len(tt.wanted))
+			}
+			for i, want := range tt.wanted {
+				if !strings.HasPrefix(got[i], want) {
+					t.Errorf("problem %d = %q, want prefix %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanStepsDriftPolicy(t *testing.T) {
+	migs := testMigrations(t)
+	applied := appliedUpTo(migs, 3)
+	delete(applied, 2)
+	up := func(migs []Migration, applied map[int64]appliedMigration) ([]step, error) {
+		return planUp(migs, applied, 0, math.MaxInt64), nil
+	}
+
+	for _, policy := range []DriftPolicy{"", DriftFail} {
+		_, err := planSteps(migs, applied, MigrateOptions{OnDrift: policy}, up)
+		var de *DriftError
+		if !errors.As(err, &de) || len(de.Problems) != 1 {
+			t.Fatalf("OnDrift=%q: err = %v, want a DriftError with one problem", policy, err)
+		}
+	}
+
+	steps, err := planSteps(migs, applied, MigrateOptions{OnDrift: DriftWarn}, up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"up 0002_b.up.sql", "up 0004_d.up.sql"}
+	if got := plan(steps); !reflect.DeepEqual(got, want) {
+		t.Fatalf("DriftWarn plan = %v, want %v", got, want)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	if checksum("SELECT 1;") != checksum("SELECT 1;") {
+		t.Fatal("checksum is not stable")
+	}
+	if checksum("SELECT 1;") == checksum("SELECT 1; ") {
+		t.Fatal("checksum ignores a whitespace edit")
+	}
+	if got := shortSum(checksum("")); got != "e3b0c44298fc" {
+		t.Fatalf("shortSum(sha256 of empty) = %q", got)
+	}
+}
+
+func TestGoMigrationChecksumCoversName(t *testing.T) {
+	up := func(context.Context, pgx.Tx) error { return nil }
+	a := GoMigration{Version: 5, Name: "backfill", Up: up}.migration()
+	b := GoMigration{Version: 5, Name: "backfill", Up: func(context.Context, pgx.Tx) error { return errors.New("changed") }}.migration()
+	c := GoMigration{Version: 5, Name: "rename", Up: up}.migration()
+
+	if a.Name != "0005_backfill.go" || a.HasDown() {
+		t.Fatalf("migration = %+v", a)
+	}
+	if a.Checksum != b.Checksum {
+		t.Error("go migration checksum depends on its code")
+	}
+	if a.Checksum == c.Checksum {
+		t.Error("renamed go migration keeps its checksum")
+	}
+}
+
+func TestPrintSteps(t *testing.T) {
+	fsys := migrationFS("0001_a.up.sql", "0001_a.down.sql")
+	fsys["0002_b.up.sql"] = &fstest.MapFile{Data: []byte("-- migrate:no-transaction\nCREATE INDEX CONCURRENTLY x ON t (id);\n")}
+	migs, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migs = append(migs, GoMigration{Version: 3, Name: "backfill", Up: func(ctx context.Context, tx pgx.Tx) error { return nil }}.migration())
+
+	var buf bytes.Buffer
+	steps := append(planUp(migs, nil, 0, math.MaxInt64), step{m: migs[0], down: true})
+	if err := printSteps(&buf, steps); err != nil {
+		t.Fatal(err)
+	}
+	want := `-- up v=1 0001_a.up.sql
+-- 0001_a.up.sql
+SELECT 1;
+-- up v=2 0002_b.up.sql (no transaction)
+-- migrate:no-transaction
+CREATE INDEX CONCURRENTLY x ON t (id);
+-- up v=3 0003_backfill.go (go function)
+-- no SQL to show
+-- down v=1 0001_a.down.sql
+-- 0001_a.down.sql
+SELECT 1;
+`
+	if buf.String() != want {
+		t.Fatalf("dry run output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := printSteps(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "-- nothing to do\n" {
+		t.Fatalf("empty plan output = %q", buf.String())
+	}
+}
@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"demo_service/internal/core/domain"
+)
+
+// outboxLease is how long a claimed batch is reserved for the relay
+// publishing it. Should that replica die mid-publish, another one takes
+// the batch over once the lease expired.
+const outboxLease = time.Minute
+
+// ProcessOutbox implements outbound.OutboxStore. The batch is claimed in a
+// short transaction and published outside of it, so a slow broker does not
+// keep a connection idle in transaction. While a claim is live no other
+// replica claims anything, so only one relays at a time and events keep
+// their order. If marking the batch sent fails after a successful publish,
+// or a publish outlasts its lease, the events are sent again: delivery is
+// at least once.
+func (r *OrderRepository) ProcessOutbox(ctx context.Context, limit int, publish func(context.Context, []domain.OrderEvent) error) (int, error) {
+	claim := rand.Int64()
+	events, err := r.claimOutbox(ctx, limit, claim)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	ids := make([]int64, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+
+	perr := publish(ctx, events)
+
+	// record the outcome even when ctx was cancelled during the publish
+	bctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if perr != nil {
+		_, err := r.pool.Exec(bctx, `
+			UPDATE outbox SET attempts = attempts + 1, last_error = $3, claim_id = NULL, claimed_until = NULL
+			WHERE id = ANY($1) AND claim_id = $2
+		`, ids, claim, perr.Error())
+		if err != nil {
+			return 0, fmt.Errorf("record outbox failure: %w (publish: %v)", err, perr)
+		}
+		return 0, fmt.Errorf("publish: %w", perr)
+	}
+
+	_, err = r.pool.Exec(bctx, `
+		UPDATE outbox SET sent_at = now(), attempts = attempts + 1, last_error = NULL, claim_id = NULL, claimed_until = NULL
+		WHERE id = ANY($1)
+	`, ids)
+	if err != nil {
+		return 0, fmt.Errorf("mark outbox sent: %w", err)
+	}
+	return len(events), nil
+}
+
+// claimOutbox leases the oldest pending events to claim, unless another
+// replica holds a live lease. The advisory lock makes the check and the
+// claim atomic across replicas.
+func (r *OrderRepository) claimOutbox(ctx context.Context, limit int, claim int64) ([]domain.OrderEvent, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, advisoryLockID("demo_service_outbox")).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("outbox lock: %w", err)
+	}
+	if !locked {
+		return nil, nil // another replica is claiming
+	}
+	var busy bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM outbox WHERE sent_at IS NULL AND claimed_until > now())
+	`).Scan(&busy)
+	if err != nil {
+		return nil, fmt.Errorf("outbox lease: %w", err)
+	}
+	if busy {
+		return nil, nil // another replica is publishing
+	}
+
+	rows, err := tx.Query(ctx, `
+		UPDATE outbox SET claim_id = $2, claimed_until = now() + make_interval(secs => $3)
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL
+			ORDER BY id
+			LIMIT $1
+		)
+		RETURNING id, event_type, order_uid, payload, created_at, attempts
+	`, limit, claim, outboxLease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim outbox: %w", err)
+	}
+	var events []domain.OrderEvent
+	for rows.Next() {
+		var e domain.OrderEvent
+		if err := rows.Scan(&e.ID, &e.Type, &e.OrderUID, &e.Payload, &e.CreatedAt, &e.Attempts); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan outbox: %w", err)
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows outbox: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit claim: %w", err)
+	}
+
+	// RETURNING does not keep the subquery's order
+	slices.SortFunc(events, func(a, b domain.OrderEvent) int { return cmp.Compare(a.ID, b.ID) })
+	return events, nil
+}
+
+// PruneOutbox implements outbound.OutboxStore.
+func (r *OrderRepository) PruneOutbox(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	tag, err := r.pool.Exec(ctx, `
+		DELETE FROM outbox
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at < $1
+			LIMIT $2
+		)
+	`, cutoff, limit)
+	if err != nil {
+		return 0, fmt.Errorf("prune outbox: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
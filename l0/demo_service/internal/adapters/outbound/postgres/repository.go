@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -12,27 +13,94 @@ import (
 )
 
 type OrderRepository struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	outbox bool
 }
 
 func NewOrderRepository(pool *pgxpool.Pool) *OrderRepository {
 	return &OrderRepository{pool: pool}
 }
 
+// EnableOutbox makes every stored order also write an order.created or
+// order.updated row to the outbox table for the relay to publish.
+func (r *OrderRepository) EnableOutbox() { r.outbox = true }
+
 func (r *OrderRepository) Upsert(ctx context.Context, order domain.Order) error {
+	return r.UpsertBatch(ctx, []domain.Order{order})
+}
+
+// UpsertBatch stores all orders in one transaction: either every order is
+// written or none is.
+func (r *OrderRepository) UpsertBatch(ctx context.Context, orders []domain.Order) error {
 	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	// orders
-	_, err = tx.Exec(ctx, `
+	for _, order := range orders {
+		if err := r.upsertOrder(ctx, tx, order); err != nil {
+			if len(orders) > 1 {
+				return fmt.Errorf("order %s: %w", order.OrderUID, err)
+			}
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// UpsertMessages stores orders like UpsertBatch and records every message
+// in the processed_messages ledger in the same transaction. Messages
+// already in the ledger are skipped; it returns the messages whose orders
+// were actually written, in input order.
+func (r *OrderRepository) UpsertMessages(ctx context.Context, msgs []domain.OrderMessage) ([]domain.OrderMessage, error) {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	applied := make([]domain.OrderMessage, 0, len(msgs))
+	for _, m := range msgs {
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO processed_messages (message_key, topic, "partition", "offset", message_id, order_uid)
+			VALUES ($1,$2,$3,$4,$5,$6)
+			ON CONFLICT (message_key) DO NOTHING
+		`, m.Ref.LedgerKey(), m.Ref.Topic, m.Ref.Partition, m.Ref.Offset, m.Ref.ID, m.Order.OrderUID)
+		if err != nil {
+			return nil, fmt.Errorf("insert ledger: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			continue // already processed
+		}
+
+		if err := r.upsertOrder(ctx, tx, m.Order); err != nil {
+			return nil, fmt.Errorf("order %s: %w", m.Order.OrderUID, err)
+		}
+		applied = append(applied, m)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+
+	return applied, nil
+}
+
+func (r *OrderRepository) upsertOrder(ctx context.Context, tx pgx.Tx, order domain.Order) error {
+	// orders; xmax is 0 only for a freshly inserted row
+	var inserted bool
+	err := tx.QueryRow(ctx, `
 		INSERT INTO orders (
 			order_uid, track_number, entry, locale, internal_signature, customer_id,
-			delivery_service, shardkey, sm_id, date_created, oof_shard, updated_at
+			delivery_service, shardkey, sm_id, date_created, oof_shard, source_topic, updated_at
 		) VALUES (
-			$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11, now()
+			$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12, now()
 		)
 		ON CONFLICT (order_uid) DO UPDATE SET
 			track_number = EXCLUDED.track_number,
@@ -45,9 +113,12 @@ func (r *OrderRepository) Upsert(ctx context.Context, order domain.Order) error
 			sm_id = EXCLUDED.sm_id,
 			date_created = EXCLUDED.date_created,
 			oof_shard = EXCLUDED.oof_shard,
+			source_topic = EXCLUDED.source_topic,
 			updated_at = now()
+		RETURNING (xmax = 0)
 	`, order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
-		order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OofShard)
+		order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OofShard,
+		order.SourceTopic).Scan(&inserted)
 	if err != nil {
 		return fmt.Errorf("upsert orders: %w", err)
 	}
@@ -113,20 +184,36 @@ func (r *OrderRepository) Upsert(ctx context.Context, order domain.Order) error
 		}
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("commit tx: %w", err)
+	if r.outbox {
+		payload, err := json.Marshal(order)
+		if err != nil {
+			return fmt.Errorf("encode outbox payload: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO outbox (event_type, order_uid, payload) VALUES ($1,$2,$3)
+		`, eventType(inserted), order.OrderUID, payload)
+		if err != nil {
+			return fmt.Errorf("insert outbox: %w", err)
+		}
 	}
 
 	return nil
 }
 
+func eventType(inserted bool) string {
+	if inserted {
+		return domain.EventOrderCreated
+	}
+	return domain.EventOrderUpdated
+}
+
 func (r *OrderRepository) GetByID(ctx context.Context, orderUID string) (domain.Order, error) {
 	var o domain.Order
 
 	row := r.pool.QueryRow(ctx, `
 		SELECT
 			o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature, o.customer_id,
-			o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
+			o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.source_topic,
 
 			d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
 
@@ -140,7 +227,7 @@ func (r *OrderRepository) GetByID(ctx context.Context, orderUID string) (domain.
 
 	err := row.Scan(
 		&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature, &o.CustomerID,
-		&o.DeliveryService, &o.ShardKey, &o.SmID, &o.DateCreated, &o.OofShard,
+		&o.DeliveryService, &o.ShardKey, &o.SmID, &o.DateCreated, &o.OofShard, &o.SourceTopic,
 
 		&o.Delivery.Name, &o.Delivery.Phone, &o.Delivery.Zip, &o.Delivery.City,
 		&o.Delivery.Address, &o.Delivery.Region, &o.Delivery.Email,
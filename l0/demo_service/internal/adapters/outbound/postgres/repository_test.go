@@ -0,0 +1,89 @@
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"demo_service/internal/adapters/outbound/postgres"
+	"demo_service/internal/adapters/outbound/repotest"
+	"demo_service/internal/migrations"
+	"demo_service/internal/ports/outbound"
+)
+
+// newRepository migrates a fresh schema and returns a repository on it.
+func newRepository(t *testing.T) *postgres.OrderRepository {
+	t.Helper()
+	db := newSchema(t, postgres.PoolConfig{})
+	if err := postgres.RunMigrations(t.Context(), db.Pool, migrations.FS(), postgres.MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return postgres.NewOrderRepository(db.Pool)
+}
+
+// newSchema creates an empty schema in the database at TEST_DATABASE_URL
+// and returns a pool configured with pc using it; the schema is dropped
+// when the test ends. Without the variable the test is skipped.
+func newSchema(t *testing.T, pc postgres.PoolConfig) *postgres.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	admin, err := postgres.New(t.Context(), dsn, postgres.PoolConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+	schema := fmt.Sprintf("repotest_%d", time.Now().UnixNano())
+	if _, err := admin.Pool.Exec(t.Context(), "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = admin.Pool.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+	})
+
+	db, err := postgres.New(t.Context(), withSearchPath(dsn, schema), pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+// withSearchPath adds a search_path runtime parameter to a URL or
+// keyword/value connection string.
+func withSearchPath(dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "search_path=" + schema
+}
+
+func TestOrderRepository(t *testing.T) {
+	repotest.TestOrderRepository(t, func(t *testing.T) outbound.OrderRepository {
+		return newRepository(t)
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	repotest.TestOutbox(t, func(t *testing.T) repotest.OutboxRepository {
+		repo := newRepository(t)
+		repo.EnableOutbox()
+		return repo
+	})
+}
+
+func TestLedger(t *testing.T) {
+	repotest.TestLedger(t, func(t *testing.T) repotest.LedgerRepository {
+		return newRepository(t)
+	})
+}
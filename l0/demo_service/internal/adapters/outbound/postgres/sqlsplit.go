@@ -0,0 +1,134 @@
+package postgres
+
+import "strings"
+
+// splitStatements cuts a SQL script into individual statements on top-level
+// semicolons. Quoted strings and identifiers (including E-prefixed escape
+// strings), dollar-quoted bodies and comments are skipped over, so
+// semicolons inside them do not split. Empty statements (only whitespace or
+// comments) are dropped.
+//
+// It is only needed for non-transactional migrations: a multi-statement
+// simple query runs as one implicit transaction in Postgres, which is
+// exactly what statements like CREATE INDEX CONCURRENTLY refuse.
+func splitStatements(sql string) []string {
+	var (
+		out   []string
+		start int
+	)
+
+	flush := func(end int) {
+		stmt := strings.TrimSpace(sql[start:end])
+		if stmt != "" && !onlyComments(stmt) {
+			out = append(out, stmt)
+		}
+		start = end + 1
+	}
+
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == ';':
+			flush(i)
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			i = skipLineComment(sql, i)
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			i = skipBlockComment(sql, i)
+		case c == '\'':
+			escapes := i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e')
+			i = skipQuoted(sql, i, '\'', escapes)
+		case c == '"':
+			i = skipQuoted(sql, i, '"', false)
+		case c == '$':
+			i = skipDollarQuoted(sql, i)
+		}
+	}
+	flush(len(sql))
+	return out
+}
+
+// skipLineComment returns the index of the newline ending the comment at i.
+func skipLineComment(sql string, i int) int {
+	if j := strings.IndexByte(sql[i:], '\n'); j >= 0 {
+		return i + j
+	}
+	return len(sql) - 1
+}
+
+// skipBlockComment returns the index of the closing '/' of the (possibly
+// nested) block comment starting at i.
+func skipBlockComment(sql string, i int) int {
+	depth := 0
+	for ; i < len(sql)-1; i++ {
+		switch {
+		case sql[i] == '/' && sql[i+1] == '*':
+			depth++
+			i++
+		case sql[i] == '*' && sql[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(sql) - 1
+}
+
+// skipQuoted returns the index of the closing quote for the literal at i.
+// A doubled quote is an escaped quote; with backslashes set, \x escapes too.
+func skipQuoted(sql string, i int, q byte, backslashes bool) int {
+	for i++; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if backslashes {
+				i++
+			}
+		case q:
+			if i+1 < len(sql) && sql[i+1] == q {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(sql) - 1
+}
+
+// skipDollarQuoted returns the index of the last '$' of a $tag$...$tag$
+// body starting at i, or i itself if this '$' does not open one (e.g. a
+// $1 parameter).
+func skipDollarQuoted(sql string, i int) int {
+	j := i + 1
+	for j < len(sql) && (sql[j] == '_' || isAlnum(sql[j])) {
+		j++
+	}
+	if j >= len(sql) || sql[j] != '$' || (j > i+1 && sql[i+1] >= '0' && sql[i+1] <= '9') {
+		return i
+	}
+	tag := sql[i : j+1]
+	if k := strings.Index(sql[j+1:], tag); k >= 0 {
+		return j + 1 + k + len(tag) - 1
+	}
+	return len(sql) - 1
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// onlyComments reports whether stmt holds nothing but whitespace and line
+// or block comments.
+func onlyComments(stmt string) bool {
+	for i := 0; i < len(stmt); i++ {
+		switch c := stmt[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		case c == '-' && i+1 < len(stmt) && stmt[i+1] == '-':
+			i = skipLineComment(stmt, i)
+		case c == '/' && i+1 < len(stmt) && stmt[i+1] == '*':
+			i = skipBlockComment(stmt, i)
+		default:
+			return false
+		}
+	}
+	return true
+}
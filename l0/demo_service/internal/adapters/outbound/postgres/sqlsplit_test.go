@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "plain",
+			sql:  "CREATE INDEX CONCURRENTLY a ON t (x);\nCREATE INDEX CONCURRENTLY b ON t (y);\n",
+			want: []string{"CREATE INDEX CONCURRENTLY a ON t (x)", "CREATE INDEX CONCURRENTLY b ON t (y)"},
+		},
+		{
+			name: "no trailing semicolon",
+			sql:  "SELECT 1; SELECT 2",
+			want: []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "dollar body",
+			sql:  "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql; SELECT 2;",
+			want: []string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", "SELECT 2"},
+		},
+		{
+			name: "tagged dollar body with nested $$",
+			sql:  "DO $fn$ BEGIN EXECUTE $$SELECT 1;$$; END $fn$; SELECT 2;",
+			want: []string{"DO $fn$ BEGIN EXECUTE $$SELECT 1;$$; END $fn$", "SELECT 2"},
+		},
+		{
+			name: "positional parameter is not a dollar quote",
+			sql:  "PREPARE p AS SELECT $1; SELECT 2;",
+			want: []string{"PREPARE p AS SELECT $1", "SELECT 2"},
+		},
+		{
+			name: "doubled quote",
+			sql:  "SELECT 'it''s; fine'; SELECT 2;",
+			want: []string{"SELECT 'it''s; fine'", "SELECT 2"},
+		},
+		{
+			name: "E-string with backslash quote",
+			sql:  `SELECT E'a\'; b'; SELECT 2;`,
+			want: []string{`SELECT E'a\'; b'`, "SELECT 2"},
+		},
+		{
+			name: "plain string keeps backslash literal",
+			sql:  `SELECT 'a\'; SELECT 2;`,
+			want: []string{`SELECT 'a\'`, "SELECT 2"},
+		},
+		{
+			name: "quoted identifier",
+			sql:  `ALTER TABLE "odd;name" ADD x int; SELECT 2;`,
+			want: []string{`ALTER TABLE "odd;name" ADD x int`, "SELECT 2"},
+		},
+		{
+			name: "nested block comment",
+			sql:  "SELECT 1 /* a /* b; */ c; */; SELECT 2;",
+			want: []string{"SELECT 1 /* a /* b; */ c; */", "SELECT 2"},
+		},
+		{
+			name: "line comment at EOF without newline",
+			sql:  "SELECT 1; -- done; really",
+			want: []string{"SELECT 1"},
+		},
+		{
+			name: "line comment hides semicolon",
+			sql:  "SELECT 1 -- not; here\n, 2;",
+			want: []string{"SELECT 1 -- not; here\n, 2"},
+		},
+		{
+			name: "comment-only trailing statement",
+			sql:  "SELECT 1;\n-- trailing note\n/* and a block */\n",
+			want: []string{"SELECT 1"},
+		},
+		{
+			name: "empty statements",
+			sql:  " ; ;\n;",
+			want: nil,
+		},
+		{
+			name: "unterminated dollar body",
+			sql:  "SELECT $x$ ; never closed",
+			want: []string{"SELECT $x$ ; never closed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitStatements(%q)\n got %q\nwant %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasNoTxDirective(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want bool
+	}{
+		{"first line", "-- migrate:no-transaction\nCREATE INDEX CONCURRENTLY a ON t (x);", true},
+		{"spaced", "--  migrate: no-transaction\nSELECT 1;", true},
+		{"after other comments and blank lines", "-- add an index\n\n-- migrate:no-transaction\nSELECT 1;", true},
+		{"absent", "-- add an index\nSELECT 1;", false},
+		{"after the first statement", "SELECT 1;\n-- migrate:no-transaction\n", false},
+		{"inside a longer comment", "-- do not use migrate:no-transaction here\nSELECT 1;", false},
+		{"empty file", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasNoTxDirective(tt.sql); got != tt.want {
+				t.Fatalf("hasNoTxDirective(%q) = %v, want %v", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"demo_service/internal/core/domain"
+	"demo_service/internal/ports/outbound"
+)
+
+// LedgerRepository is a repository whose processed-message ledger can be
+// pruned.
+type LedgerRepository interface {
+	outbound.OrderRepository
+	outbound.LedgerStore
+}
+
+// TestLedger checks pruning of the processed-message ledger as subtests:
+// entries newer than the cutoff are kept, older ones are deleted at most
+// limit at a time, and a message whose entry was pruned is applied again.
+// newRepo must return an empty repository, a fresh one on every call.
+func TestLedger(t *testing.T, newRepo func(t *testing.T) LedgerRepository) {
+	later := time.Now().Add(time.Hour)
+
+	t.Run("newer entries kept", func(t *testing.T) {
+		repo := newRepo(t)
+		deliver(t, repo, 1)
+		prune(t, repo, time.Now().Add(-time.Hour), 10, 0)
+		if n := deliver(t, repo, 1); n != 0 {
+			t.Errorf("redelivery before pruning: applied %d, want a duplicate", n)
+		}
+	})
+
+	t.Run("pruned message applied again", func(t *testing.T) {
+		repo := newRepo(t)
+		deliver(t, repo, 1)
+		prune(t, repo, later, 10, 1)
+		if n := deliver(t, repo, 1); n != 1 {
+			t.Errorf("redelivery after pruning: applied %d, want it applied again", n)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		repo := newRepo(t)
+		deliver(t, repo, 1, 2, 3)
+		for _, want := range []int{2, 1, 0} {
+			prune(t, repo, later, 2, want)
+		}
+	})
+}
+
+// deliver stores one message per offset and returns how many were applied.
+func deliver(t *testing.T, repo outbound.OrderRepository, offsets ...int64) int {
+	t.Helper()
+	msgs := make([]domain.OrderMessage, len(offsets))
+	for i, o := range offsets {
+		msgs[i] = domain.OrderMessage{Ref: domain.MessageRef{Topic: "repotest", Offset: o}, Order: Order(int(o))}
+	}
+	applied, err := repo.UpsertMessages(t.Context(), msgs)
+	if err != nil {
+		t.Fatalf("upsert messages: %v", err)
+	}
+	return len(applied)
+}
+
+func prune(t *testing.T, ledger outbound.LedgerStore, cutoff time.Time, limit, want int) {
+	t.Helper()
+	n, err := ledger.PruneLedger(t.Context(), cutoff, limit)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if n != want {
+		t.Fatalf("pruned %d entries, want %d", n, want)
+	}
+}
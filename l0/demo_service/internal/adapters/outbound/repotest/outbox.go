@@ -0,0 +1,160 @@
+package repotest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"demo_service/internal/core/domain"
+	"demo_service/internal/ports/outbound"
+)
+
+// OutboxRepository is a repository that records order events in its
+// outbox.
+type OutboxRepository interface {
+	outbound.OrderRepository
+	outbound.OutboxStore
+}
+
+// TestOutbox checks an outbox-enabled repository as subtests: every stored
+// order queues exactly one event of the right type, events come out in
+// order, a failed publish leaves them pending, and pruning removes sent
+// events only. newRepo must return an empty repository, a fresh one on
+// every call.
+func TestOutbox(t *testing.T, newRepo func(t *testing.T) OutboxRepository) {
+	t.Run("events in order", func(t *testing.T) {
+		repo := newRepo(t)
+		want := seedOutbox(t, repo)
+		got := drain(t, repo, 3)
+		checkEvents(t, got, want, 0)
+	})
+
+	t.Run("failed publish keeps events", func(t *testing.T) {
+		repo := newRepo(t)
+		want := seedOutbox(t, repo)
+
+		errPublish := errors.New("broker down")
+		var seen []domain.OrderEvent
+		n, err := repo.ProcessOutbox(t.Context(), 10, func(_ context.Context, events []domain.OrderEvent) error {
+			seen = events
+			return errPublish
+		})
+		if !errors.Is(err, errPublish) || n != 0 {
+			t.Fatalf("failed publish: n=%d err=%v, want 0 and the publish error", n, err)
+		}
+		if len(seen) != len(want) {
+			t.Fatalf("failed publish saw %d events, want %d", len(seen), len(want))
+		}
+		checkEvents(t, drain(t, repo, 10), want, 1)
+	})
+
+	t.Run("prune keeps pending events", func(t *testing.T) {
+		repo := newRepo(t)
+		upsert(t, repo, 1)
+		drain(t, repo, 10)
+		upsert(t, repo, 2)
+
+		n, err := repo.PruneOutbox(t.Context(), time.Now().Add(time.Hour), 100)
+		if err != nil {
+			t.Fatalf("prune: %v", err)
+		}
+		// memory keeps no sent events
+		if n > 1 {
+			t.Errorf("pruned %d events, want at most the one sent", n)
+		}
+		pending := drain(t, repo, 10)
+		if len(pending) != 1 || pending[0].OrderUID != Order(2).OrderUID {
+			t.Fatalf("after prune: pending %d events, want the one of %s", len(pending), Order(2).OrderUID)
+		}
+	})
+}
+
+type wantEvent struct {
+	typ   string
+	order domain.Order
+}
+
+// seedOutbox writes orders through every write method and returns the
+// events they must queue.
+func seedOutbox(t *testing.T, repo outbound.OrderRepository) []wantEvent {
+	t.Helper()
+	ctx := t.Context()
+	updated := Order(1)
+	updated.TrackNumber = "TRACK-OUTBOX"
+
+	upsert(t, repo, 1)
+	if err := repo.Upsert(ctx, updated); err != nil {
+		t.Fatalf("upsert again: %v", err)
+	}
+	if err := repo.UpsertBatch(ctx, []domain.Order{Order(2)}); err != nil {
+		t.Fatalf("upsert batch: %v", err)
+	}
+	msg := domain.OrderMessage{Ref: domain.MessageRef{Topic: "repotest", Offset: 1}, Order: Order(3)}
+	for range 2 { // the redelivery must not queue a second event
+		if _, err := repo.UpsertMessages(ctx, []domain.OrderMessage{msg}); err != nil {
+			t.Fatalf("upsert messages: %v", err)
+		}
+	}
+	return []wantEvent{
+		{domain.EventOrderCreated, Order(1)},
+		{domain.EventOrderUpdated, updated},
+		{domain.EventOrderCreated, Order(2)},
+		{domain.EventOrderCreated, Order(3)},
+	}
+}
+
+// drain publishes every pending event, batch events at a time, and checks
+// that nothing is pending afterwards.
+func drain(t *testing.T, outbox outbound.OutboxStore, batch int) []domain.OrderEvent {
+	t.Helper()
+	var got []domain.OrderEvent
+	for {
+		n, err := outbox.ProcessOutbox(t.Context(), batch, func(_ context.Context, events []domain.OrderEvent) error {
+			got = append(got, events...)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	n, err := outbox.ProcessOutbox(t.Context(), batch, func(context.Context, []domain.OrderEvent) error {
+		return errors.New("sent events published again")
+	})
+	if err != nil || n != 0 {
+		t.Fatalf("after drain: n=%d err=%v, want nothing pending", n, err)
+	}
+	return got
+}
+
+func checkEvents(t *testing.T, got []domain.OrderEvent, want []wantEvent, attempts int) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d events, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		e := got[i]
+		if e.Type != w.typ || e.OrderUID != w.order.OrderUID {
+			t.Errorf("event %d = %s %s, want %s %s", i, e.Type, e.OrderUID, w.typ, w.order.OrderUID)
+		}
+		if i > 0 && e.ID <= got[i-1].ID {
+			t.Errorf("event ids not increasing: %d after %d", e.ID, got[i-1].ID)
+		}
+		if e.Attempts != attempts {
+			t.Errorf("event %d attempts = %d, want %d", i, e.Attempts, attempts)
+		}
+		var o domain.Order
+		if err := json.Unmarshal(e.Payload, &o); err != nil {
+			t.Errorf("event %d payload: %v", i, err)
+			continue
+		}
+		if o.TrackNumber != w.order.TrackNumber {
+			t.Errorf("event %d payload track_number = %q, want %q", i, o.TrackNumber, w.order.TrackNumber)
+		}
+	}
+}
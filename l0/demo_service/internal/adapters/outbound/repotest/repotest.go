@@ -0,0 +1,379 @@
+// Package repotest holds a conformance suite for outbound.OrderRepository
+// implementations: every adapter (postgres, sqlite, memory) runs the same
+// subtests from its own _test.go, so they stay interchangeable behind the
+// port.
+package repotest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"demo_service/internal/core/domain"
+	"demo_service/internal/ports/outbound"
+)
+
+// TestOrderRepository runs the conformance checks as subtests. newRepo
+// must return an empty repository, a fresh one on every call; it gets the
+// subtest's t for Fatal and Cleanup.
+func TestOrderRepository(t *testing.T, newRepo func(t *testing.T) outbound.OrderRepository) {
+	checks := []struct {
+		name string
+		fn   func(*testing.T, outbound.OrderRepository)
+	}{
+		{"empty", checkEmpty},
+		{"not found", checkNotFound},
+		{"round trip", checkRoundTrip},
+		{"upsert replaces", checkUpsertReplaces},
+		{"ordering", checkOrdering},
+		{"pagination", checkPagination},
+		{"batch upsert", checkUpsertBatch},
+		{"message ledger", checkUpsertMessages},
+	}
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			c.fn(t, newRepo(t))
+		})
+	}
+}
+
+// Order builds a valid order whose uid and creation time derive from seq,
+// so a higher seq is always newer.
+func Order(seq int) domain.Order {
+	uid := fmt.Sprintf("repotest-%04d", seq)
+	return domain.Order{
+		OrderUID:          uid,
+		TrackNumber:       fmt.Sprintf("TRACK%04d", seq),
+		Entry:             "WBIL",
+		Locale:            "en",
+		InternalSignature: "",
+		CustomerID:        "test",
+		DeliveryService:   "meest",
+		ShardKey:          "9",
+		SmID:              99,
+		DateCreated:       time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC).Add(time.Duration(seq) * time.Minute),
+		OofShard:          "1",
+		SourceTopic:       "orders-repotest",
+		Delivery: domain.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: domain.Payment{
+			Transaction:  uid,
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDT:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []domain.Item{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, RID: "ab4219087a764ae0btest", Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202},
+			{ChrtID: 9934931, TrackNumber: "WBILMTESTTRACK", Price: 100, RID: "ab4219087a764ae0btest2", Name: "Brush", Sale: 0, Size: "0", TotalPrice: 100, NmID: 2389213, Brand: "Vivienne Sabo", Status: 202},
+		},
+	}
+}
+
+func upsert(t *testing.T, repo outbound.OrderRepository, seqs ...int) {
+	t.Helper()
+	for _, seq := range seqs {
+		if err := repo.Upsert(t.Context(), Order(seq)); err != nil {
+			t.Fatalf("upsert %d: %v", seq, err)
+		}
+	}
+}
+
+func checkEmpty(t *testing.T, repo outbound.OrderRepository) {
+	ctx := t.Context()
+	n, err := repo.CountOrders(ctx)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != 0 {
+		t.Fatalf("repository must start empty, has %d orders", n)
+	}
+
+	latest, err := repo.ListLatest(ctx, 10)
+	if err != nil {
+		t.Fatalf("list latest: %v", err)
+	}
+	if len(latest) != 0 {
+		t.Errorf("list latest on empty repo returned %d orders", len(latest))
+	}
+
+	none, err := repo.ListLatest(ctx, 0)
+	if err != nil {
+		t.Fatalf("list latest(0): %v", err)
+	}
+	if none == nil || len(none) != 0 {
+		t.Errorf("list latest(0) = %v, want empty non-nil slice", none)
+	}
+}
+
+func checkNotFound(t *testing.T, repo outbound.OrderRepository) {
+	_, err := repo.GetByID(t.Context(), "repotest-missing")
+	if !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("get missing order: err=%v, want domain.ErrNotFound", err)
+	}
+}
+
+func checkRoundTrip(t *testing.T, repo outbound.OrderRepository) {
+	ctx := t.Context()
+	want := Order(1)
+	if err := repo.Upsert(ctx, want); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, want.OrderUID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if err := equalOrders(got, want); err != nil {
+		t.Error(err)
+	}
+
+	// the stored copy must not alias the caller's slice
+	want.Items[0].Name = "mutated"
+	got, err = repo.GetByID(ctx, want.OrderUID)
+	if err != nil {
+		t.Fatalf("get after caller mutation: %v", err)
+	}
+	if got.Items[0].Name == "mutated" {
+		t.Error("stored order aliases caller's items slice")
+	}
+}
+
+func checkUpsertReplaces(t *testing.T, repo outbound.OrderRepository) {
+	ctx := t.Context()
+	upsert(t, repo, 1)
+
+	want := Order(1)
+	want.TrackNumber = "TRACK-UPDATED"
+	want.Delivery.City = "Moscow"
+	want.Payment.Amount = 42
+	want.Items = want.Items[1:]
+	if err := repo.Upsert(ctx, want); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, want.OrderUID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if err := equalOrders(got, want); err != nil {
+		t.Error(err)
+	}
+
+	n, err := repo.CountOrders(ctx)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("count after re-upsert = %d, want 1", n)
+	}
+
+	want.Items = nil
+	if err := repo.Upsert(ctx, want); err != nil {
+		t.Fatalf("upsert without items: %v", err)
+	}
+	got, err = repo.GetByID(ctx, want.OrderUID)
+	if err != nil {
+		t.Fatalf("get without items: %v", err)
+	}
+	if len(got.Items) != 0 {
+		t.Errorf("items after upsert without items = %d, want 0", len(got.Items))
+	}
+}
+
+func checkOrdering(t *testing.T, repo outbound.OrderRepository) {
+	ctx := t.Context()
+	upsert(t, repo, 3, 1, 2, 5, 4) // out of order
+
+	latest, err := repo.ListLatest(ctx, 3)
+	if err != nil {
+		t.Fatalf("list latest: %v", err)
+	}
+	if err := sameUIDs(orderUIDs(latest), uidsFor(5, 4, 3)); err != nil {
+		t.Errorf("list latest: %v", err)
+	}
+
+	all, err := repo.ListLatest(ctx, 100)
+	if err != nil {
+		t.Fatalf("list latest all: %v", err)
+	}
+	if err := sameUIDs(orderUIDs(all), uidsFor(5, 4, 3, 2, 1)); err != nil {
+		t.Fatalf("list latest all: %v", err)
+	}
+	if err := equalOrders(all[0], Order(5)); err != nil {
+		t.Errorf("list latest returns full orders: %v", err)
+	}
+}
+
+func checkPagination(t *testing.T, repo outbound.OrderRepository) {
+	ctx := t.Context()
+	upsert(t, repo, 1, 2, 3, 4, 5)
+
+	n, err := repo.CountOrders(ctx)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("count = %d, want 5", n)
+	}
+
+	pages := []struct {
+		limit, offset int
+		want          []string
+	}{
+		{2, 0, uidsFor(5, 4)},
+		{2, 2, uidsFor(3, 2)},
+		{2, 4, uidsFor(1)},
+		{2, 6, nil},
+	}
+	for _, p := range pages {
+		got, err := repo.ListOrderUIDs(ctx, p.limit, p.offset)
+		if err != nil {
+			t.Fatalf("list uids(%d, %d): %v", p.limit, p.offset, err)
+		}
+		if err := sameUIDs(got, p.want); err != nil {
+			t.Errorf("list uids(%d, %d): %v", p.limit, p.offset, err)
+		}
+	}
+}
+
+func checkUpsertBatch(t *testing.T, repo outbound.OrderRepository) {
+	ctx := t.Context()
+	upsert(t, repo, 1)
+
+	updated := Order(1)
+	updated.TrackNumber = "TRACK-BATCH"
+	batch := []domain.Order{Order(100), updated, Order(101)}
+	if err := repo.UpsertBatch(ctx, batch); err != nil {
+		t.Fatalf("upsert batch: %v", err)
+	}
+
+	n, err := repo.CountOrders(ctx)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("count after batch = %d, want 3", n)
+	}
+	for _, want := range batch {
+		got, err := repo.GetByID(ctx, want.OrderUID)
+		if err != nil {
+			t.Fatalf("get %s: %v", want.OrderUID, err)
+		}
+		if err := equalOrders(got, want); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := repo.UpsertBatch(ctx, nil); err != nil {
+		t.Errorf("empty batch: %v", err)
+	}
+}
+
+func checkUpsertMessages(t *testing.T, repo outbound.OrderRepository) {
+	ctx := t.Context()
+	ref := func(offset int64) domain.MessageRef {
+		return domain.MessageRef{Topic: "repotest", Partition: 1, Offset: offset}
+	}
+	first := []domain.OrderMessage{
+		{Ref: ref(10), Order: Order(200)},
+		{Ref: domain.MessageRef{Topic: "repotest", Offset: 11, ID: "evt-1"}, Order: Order(201)},
+		{Ref: ref(10), Order: Order(202)}, // same message twice in one batch
+	}
+	applied, err := repo.UpsertMessages(ctx, first)
+	if err != nil {
+		t.Fatalf("first delivery: %v", err)
+	}
+	if err := sameUIDs(messageUIDs(applied), uidsFor(200, 201)); err != nil {
+		t.Errorf("first delivery: %v", err)
+	}
+
+	changed := Order(200)
+	changed.TrackNumber = "TRACK-REDELIVERED"
+	again := []domain.OrderMessage{
+		{Ref: ref(10), Order: changed},
+		// same id at another offset: a re-publish of the same event
+		{Ref: domain.MessageRef{Topic: "repotest", Offset: 99, ID: "evt-1"}, Order: Order(201)},
+		{Ref: ref(12), Order: Order(203)},
+	}
+	applied, err = repo.UpsertMessages(ctx, again)
+	if err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	if err := sameUIDs(messageUIDs(applied), uidsFor(203)); err != nil {
+		t.Errorf("redelivery: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, changed.OrderUID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.TrackNumber == changed.TrackNumber {
+		t.Error("duplicate message was applied")
+	}
+	if _, err := repo.GetByID(ctx, Order(202).OrderUID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("order from duplicate in batch: err = %v, want ErrNotFound", err)
+	}
+}
+
+func equalOrders(got, want domain.Order) error {
+	if !got.DateCreated.Equal(want.DateCreated) {
+		return fmt.Errorf("date_created = %v, want %v", got.DateCreated, want.DateCreated)
+	}
+	got.DateCreated, want.DateCreated = time.Time{}, time.Time{}
+	if len(got.Items) == 0 && len(want.Items) == 0 {
+		got.Items, want.Items = nil, nil
+	}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("order mismatch:\n got  %+v\n want %+v", got, want)
+	}
+	return nil
+}
+
+func orderUIDs(orders []domain.Order) []string {
+	out := make([]string, 0, len(orders))
+	for _, o := range orders {
+		out = append(out, o.OrderUID)
+	}
+	return out
+}
+
+func uidsFor(seqs ...int) []string {
+	out := make([]string, 0, len(seqs))
+	for _, s := range seqs {
+		out = append(out, Order(s).OrderUID)
+	}
+	return out
+}
+
+func messageUIDs(msgs []domain.OrderMessage) []string {
+	out := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, m.Order.OrderUID)
+	}
+	return out
+}
+
+func sameUIDs(got, want []string) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return fmt.Errorf("got %v, want %v", got, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type DB struct {
+	SQL *sql.DB
+}
+
+// New opens (creating if needed) the database file at path. SQLite allows a
+// single writer, so the pool is capped at one connection: writes queue in
+// database/sql instead of failing with SQLITE_BUSY, and ":memory:" keeps
+// pointing at the same database.
+func New(ctx context.Context, path string) (*DB, error) {
+	db, err := sql.Open("sqlite", dsn(path))
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+
+	ctxPing, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctxPing); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("ping sqlite: %w", err)
+	}
+
+	return &DB{SQL: db}, nil
+}
+
+func (d *DB) Close() {
+	if d != nil && d.SQL != nil {
+		_ = d.SQL.Close()
+	}
+}
+
+func (d *DB) Stats() sql.DBStats {
+	if d == nil || d.SQL == nil {
+		return sql.DBStats{}
+	}
+	return d.SQL.Stats()
+}
+
+func dsn(path string) string {
+	pragmas := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	if path != ":memory:" {
+		pragmas += "&_pragma=journal_mode(WAL)"
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
+	}
+	return path + sep + pragmas
+}
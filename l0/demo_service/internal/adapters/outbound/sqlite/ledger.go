@@ -0,0 +1,27 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PruneLedger implements outbound.LedgerStore.
+func (r *OrderRepository) PruneLedger(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM processed_messages
+		WHERE message_key IN (
+			SELECT message_key FROM processed_messages
+			WHERE processed_at < ?
+			LIMIT ?
+		)
+	`, cutoff.UnixMicro(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("prune ledger: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("prune ledger: %w", err)
+	}
+	return int(n), nil
+}
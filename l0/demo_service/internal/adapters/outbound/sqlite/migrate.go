@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+
+	"demo_service/internal/migrations"
+)
+
+// Migration follows the same file layout as the postgres runner, read by
+// migrations.ReadFiles: NNNN_name.up.sql files applied in version order,
+// each in its own transaction, and recorded in schema_migrations.
+//
+// The sqlite runner is deliberately forward-only. It is meant for local
+// runs and tests on a throwaway file, so it has none of the postgres
+// runner's down migrations, checksums, drift detection or locking; the
+// .down.sql files next to the up files are for reverting by hand. Its
+// versions are a sequence of their own and do not match the postgres
+// numbers for the same tables.
+type Migration struct {
+	Version int64
+	Name    string
+	SQL     string
+}
+
+func RunMigrations(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+	migs, err := loadMigrations(fsys)
+	if err != nil {
+		return fmt.Errorf("load migrations: %w", err)
+	}
+	if len(migs) == 0 {
+		return nil
+	}
+
+	// no advisory lock: the pool holds a single connection and sqlite
+	// serializes writers on the file lock anyway
+
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migs {
+		if applied[m.Version] {
+			continue
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("begin tx (v=%d): %w", m.Version, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("exec migration (v=%d, %s): %w", m.Version, m.Name, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO schema_migrations (version, name, applied_at)
+			VALUES (?, ?, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+		`, m.Version, m.Name); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("record migration (v=%d): %w", m.Version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration (v=%d): %w", m.Version, err)
+		}
+	}
+
+	return nil
+}
+
+func ensureMigrationsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func appliedVersions(ctx context.Context, db *sql.DB) (map[int64]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[int64]bool)
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("scan version: %w", err)
+		}
+		out[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows err: %w", err)
+	}
+	return out, nil
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := migrations.ReadFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	var migs []Migration
+	for _, f := range files {
+		if !f.Up {
+			continue
+		}
+		if n := len(migs); n > 0 && migs[n-1].Version == f.Version {
+			return nil, fmt.Errorf("duplicate up migration v=%d: %s and %s", f.Version, migs[n-1].Name, f.Name)
+		}
+		migs = append(migs, Migration{Version: f.Version, Name: f.Name, SQL: f.SQL})
+	}
+	return migs, nil
+}
@@ -0,0 +1,139 @@
+package sqlite_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"demo_service/internal/adapters/outbound/sqlite"
+	"demo_service/internal/migrations"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sqlite.New(t.Context(), filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db.SQL
+}
+
+func appliedVersions(t *testing.T, db *sql.DB) []int64 {
+	t.Helper()
+	rows, err := db.QueryContext(t.Context(), `SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var out []int64
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func file(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+
+func TestRunMigrations(t *testing.T) {
+	db := openDB(t)
+	fsys := fstest.MapFS{
+		"0002_b.up.sql":   file(`CREATE TABLE b (id INTEGER); INSERT INTO b VALUES (1);`),
+		"0001_a.up.sql":   file(`CREATE TABLE a (id INTEGER);`),
+		"0001_a.down.sql": file(`DROP TABLE a;`),
+		"README.md":       file(`not a migration`),
+	}
+	if err := sqlite.RunMigrations(t.Context(), db, fsys); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedVersions(t, db); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Fatalf("applied %v, want [1 2]", got)
+	}
+
+	// applied versions are skipped, new ones applied
+	fsys["0003_c.up.sql"] = file(`CREATE TABLE c (id INTEGER);`)
+	if err := sqlite.RunMigrations(t.Context(), db, fsys); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if got := appliedVersions(t, db); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Fatalf("applied %v, want [1 2 3]", got)
+	}
+	var n int
+	if err := db.QueryRowContext(t.Context(), `SELECT count(*) FROM b`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("b has %d rows (err %v), want 1: a migration ran twice", n, err)
+	}
+}
+
+func TestRunMigrationsFailureRollsBack(t *testing.T) {
+	db := openDB(t)
+	fsys := fstest.MapFS{
+		"0001_a.up.sql": file(`CREATE TABLE a (id INTEGER);`),
+		"0002_b.up.sql": file(`CREATE TABLE b (id INTEGER); INSERT INTO missing VALUES (1);`),
+	}
+	err := sqlite.RunMigrations(t.Context(), db, fsys)
+	if err == nil || !strings.Contains(err.Error(), "v=2") {
+		t.Fatalf("error %v, want the failing v=2", err)
+	}
+	if got := appliedVersions(t, db); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("applied %v, want [1]", got)
+	}
+	var name string
+	err = db.QueryRowContext(t.Context(), `SELECT name FROM sqlite_master WHERE name = 'b'`).Scan(&name)
+	if err != sql.ErrNoRows {
+		t.Errorf("table b exists after its migration failed (err %v)", err)
+	}
+}
+
+func TestRunMigrationsRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{"bad name", fstest.MapFS{"init.up.sql": file(`SELECT 1;`)}, "invalid migration filename"},
+		{"duplicate version", fstest.MapFS{
+			"0001_a.up.sql": file(`SELECT 1;`),
+			"0001_b.up.sql": file(`SELECT 1;`),
+		}, "duplicate up migration v=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sqlite.RunMigrations(t.Context(), openDB(t), tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrationsRerun(t *testing.T) {
+	db := openDB(t)
+	for range 2 {
+		if err := sqlite.RunMigrations(t.Context(), db, migrations.SQLiteFS()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := migrations.ReadFiles(migrations.SQLiteFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ups int
+	for _, f := range files {
+		if f.Up {
+			ups++
+		}
+	}
+	if got := appliedVersions(t, db); len(got) != ups {
+		t.Errorf("applied %v, want all %d embedded migrations", got, ups)
+	}
+}
@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"demo_service/internal/core/domain"
+)
+
+// ProcessOutbox implements outbound.OutboxStore. SQLite is only ever used
+// by one process, so the batch is read, published and marked in separate
+// steps rather than holding the single connection during the publish.
+func (r *OrderRepository) ProcessOutbox(ctx context.Context, limit int, publish func(context.Context, []domain.OrderEvent) error) (int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, event_type, order_uid, payload, created_at, attempts
+		FROM outbox
+		WHERE sent_at IS NULL
+		ORDER BY id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("query outbox: %w", err)
+	}
+	var events []domain.OrderEvent
+	var ids []any
+	for rows.Next() {
+		var (
+			e       domain.OrderEvent
+			payload string
+			created int64
+		)
+		if err := rows.Scan(&e.ID, &e.Type, &e.OrderUID, &payload, &created, &e.Attempts); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("scan outbox: %w", err)
+		}
+		e.Payload = []byte(payload)
+		e.CreatedAt = time.UnixMicro(created).UTC()
+		events = append(events, e)
+		ids = append(ids, e.ID)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows outbox: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	in := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	if perr := publish(ctx, events); perr != nil {
+		args := append([]any{perr.Error()}, ids...)
+		_, err := r.db.ExecContext(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error = ? WHERE id IN (`+in+`)`, args...)
+		if err != nil {
+			return 0, fmt.Errorf("record outbox failure: %w (publish: %v)", err, perr)
+		}
+		return 0, fmt.Errorf("publish: %w", perr)
+	}
+
+	args := append([]any{time.Now().UnixMicro()}, ids...)
+	_, err = r.db.ExecContext(ctx, `UPDATE outbox SET sent_at = ?, attempts = attempts + 1, last_error = NULL WHERE id IN (`+in+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("mark outbox sent: %w", err)
+	}
+	return len(events), nil
+}
+
+// PruneOutbox implements outbound.OutboxStore.
+func (r *OrderRepository) PruneOutbox(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM outbox
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at < ?
+			LIMIT ?
+		)
+	`, cutoff.UnixMicro(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("prune outbox: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("prune outbox: %w", err)
+	}
+	return int(n), nil
+}
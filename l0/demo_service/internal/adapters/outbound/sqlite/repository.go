@@ -0,0 +1,338 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"demo_service/internal/core/domain"
+	"demo_service/internal/ports/outbound"
+)
+
+type OrderRepository struct {
+	db     *sql.DB
+	outbox bool
+}
+
+func NewOrderRepository(db *sql.DB) *OrderRepository {
+	return &OrderRepository{db: db}
+}
+
+// EnableOutbox makes every stored order also write an order.created or
+// order.updated row to the outbox table for the relay to publish.
+func (r *OrderRepository) EnableOutbox() { r.outbox = true }
+
+func (r *OrderRepository) Upsert(ctx context.Context, order domain.Order) error {
+	return r.UpsertBatch(ctx, []domain.Order{order})
+}
+
+// UpsertBatch stores all orders in one transaction: either every order is
+// written or none is.
+func (r *OrderRepository) UpsertBatch(ctx context.Context, orders []domain.Order) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, order := range orders {
+		if err := r.upsertOrder(ctx, tx, order); err != nil {
+			if len(orders) > 1 {
+				return fmt.Errorf("order %s: %w", order.OrderUID, err)
+			}
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// UpsertMessages stores orders like UpsertBatch and records every message
+// in the processed_messages ledger in the same transaction. Messages
+// already in the ledger are skipped; it returns the messages whose orders
+// were actually written, in input order.
+func (r *OrderRepository) UpsertMessages(ctx context.Context, msgs []domain.OrderMessage) ([]domain.OrderMessage, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UnixMicro()
+	applied := make([]domain.OrderMessage, 0, len(msgs))
+	for _, m := range msgs {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO processed_messages (message_key, topic, "partition", "offset", message_id, order_uid, processed_at)
+			VALUES (?,?,?,?,?,?,?)
+			ON CONFLICT (message_key) DO NOTHING
+		`, m.Ref.LedgerKey(), m.Ref.Topic, m.Ref.Partition, m.Ref.Offset, m.Ref.ID, m.Order.OrderUID, now)
+		if err != nil {
+			return nil, fmt.Errorf("insert ledger: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("insert ledger: %w", err)
+		} else if n == 0 {
+			continue // already processed
+		}
+
+		if err := r.upsertOrder(ctx, tx, m.Order); err != nil {
+			return nil, fmt.Errorf("order %s: %w", m.Order.OrderUID, err)
+		}
+		applied = append(applied, m)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+
+	return applied, nil
+}
+
+func (r *OrderRepository) upsertOrder(ctx context.Context, tx *sql.Tx, order domain.Order) error {
+	now := time.Now().UnixMicro()
+
+	var exists bool
+	if r.outbox {
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE order_uid = ?)`, order.OrderUID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("check order: %w", err)
+		}
+	}
+
+	// orders
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO orders (
+			order_uid, track_number, entry, locale, internal_signature, customer_id,
+			delivery_service, shardkey, sm_id, date_created, oof_shard, source_topic, updated_at
+		) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)
+		ON CONFLICT (order_uid) DO UPDATE SET
+			track_number = excluded.track_number,
+			entry = excluded.entry,
+			locale = excluded.locale,
+			internal_signature = excluded.internal_signature,
+			customer_id = excluded.customer_id,
+			delivery_service = excluded.delivery_service,
+			shardkey = excluded.shardkey,
+			sm_id = excluded.sm_id,
+			date_created = excluded.date_created,
+			oof_shard = excluded.oof_shard,
+			source_topic = excluded.source_topic,
+			updated_at = excluded.updated_at
+	`, order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID,
+		order.DateCreated.UnixMicro(), order.OofShard, order.SourceTopic, now)
+	if err != nil {
+		return fmt.Errorf("upsert orders: %w", err)
+	}
+
+	// deliveries
+	d := order.Delivery
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email)
+		VALUES (?,?,?,?,?,?,?,?)
+		ON CONFLICT (order_uid) DO UPDATE SET
+			name=excluded.name,
+			phone=excluded.phone,
+			zip=excluded.zip,
+			city=excluded.city,
+			address=excluded.address,
+			region=excluded.region,
+			email=excluded.email
+	`, order.OrderUID, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email)
+	if err != nil {
+		return fmt.Errorf("upsert deliveries: %w", err)
+	}
+
+	// payments
+	p := order.Payment
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO payments (
+			order_uid, "transaction", request_id, currency, provider, amount, payment_dt, bank,
+			delivery_cost, goods_total, custom_fee
+		) VALUES (?,?,?,?,?,?,?,?,?,?,?)
+		ON CONFLICT (order_uid) DO UPDATE SET
+			"transaction"=excluded."transaction",
+			request_id=excluded.request_id,
+			currency=excluded.currency,
+			provider=excluded.provider,
+			amount=excluded.amount,
+			payment_dt=excluded.payment_dt,
+			bank=excluded.bank,
+			delivery_cost=excluded.delivery_cost,
+			goods_total=excluded.goods_total,
+			custom_fee=excluded.custom_fee
+	`, order.OrderUID, p.Transaction, p.RequestID, p.Currency, p.Provider, p.Amount,
+		p.PaymentDT, p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee)
+	if err != nil {
+		return fmt.Errorf("upsert payments: %w", err)
+	}
+
+	// items
+	_, err = tx.ExecContext(ctx, `DELETE FROM items WHERE order_uid = ?`, order.OrderUID)
+	if err != nil {
+		return fmt.Errorf("delete items: %w", err)
+	}
+
+	for _, it := range order.Items {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO items (
+				order_uid, chrt_id, track_number, price, rid, name, sale, size,
+				total_price, nm_id, brand, status
+			) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)
+		`, order.OrderUID, it.ChrtID, it.TrackNumber, it.Price, it.RID, it.Name,
+			it.Sale, it.Size, it.TotalPrice, it.NmID, it.Brand, it.Status)
+		if err != nil {
+			return fmt.Errorf("insert item: %w", err)
+		}
+	}
+
+	if r.outbox {
+		payload, err := json.Marshal(order)
+		if err != nil {
+			return fmt.Errorf("encode outbox payload: %w", err)
+		}
+		typ := domain.EventOrderCreated
+		if exists {
+			typ = domain.EventOrderUpdated
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO outbox (event_type, order_uid, payload, created_at) VALUES (?,?,?,?)
+		`, typ, order.OrderUID, string(payload), now)
+		if err != nil {
+			return fmt.Errorf("insert outbox: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *OrderRepository) GetByID(ctx context.Context, orderUID string) (domain.Order, error) {
+	var (
+		o           domain.Order
+		dateCreated int64
+	)
+
+	row := r.db.QueryRowContext(ctx, `
+		SELECT
+			o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature, o.customer_id,
+			o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.source_topic,
+
+			d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+
+			p."transaction", p.request_id, p.currency, p.provider, p.amount, p.payment_dt, p.bank,
+			p.delivery_cost, p.goods_total, p.custom_fee
+		FROM orders o
+		JOIN deliveries d ON d.order_uid = o.order_uid
+		JOIN payments p ON p.order_uid = o.order_uid
+		WHERE o.order_uid = ?
+	`, orderUID)
+
+	err := row.Scan(
+		&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature, &o.CustomerID,
+		&o.DeliveryService, &o.ShardKey, &o.SmID, &dateCreated, &o.OofShard, &o.SourceTopic,
+
+		&o.Delivery.Name, &o.Delivery.Phone, &o.Delivery.Zip, &o.Delivery.City,
+		&o.Delivery.Address, &o.Delivery.Region, &o.Delivery.Email,
+
+		&o.Payment.Transaction, &o.Payment.RequestID, &o.Payment.Currency, &o.Payment.Provider,
+		&o.Payment.Amount, &o.Payment.PaymentDT, &o.Payment.Bank, &o.Payment.DeliveryCost,
+		&o.Payment.GoodsTotal, &o.Payment.CustomFee,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Order{}, domain.ErrNotFound
+		}
+		return domain.Order{}, fmt.Errorf("scan order: %w", err)
+	}
+	o.DateCreated = time.UnixMicro(dateCreated).UTC()
+
+	// items
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+		FROM items
+		WHERE order_uid = ?
+		ORDER BY id ASC
+	`, orderUID)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("query items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var it domain.Item
+		if err := rows.Scan(
+			&it.ChrtID, &it.TrackNumber, &it.Price, &it.RID, &it.Name,
+			&it.Sale, &it.Size, &it.TotalPrice, &it.NmID, &it.Brand, &it.Status,
+		); err != nil {
+			return domain.Order{}, fmt.Errorf("scan item: %w", err)
+		}
+		o.Items = append(o.Items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return domain.Order{}, fmt.Errorf("items rows: %w", err)
+	}
+
+	return o, nil
+}
+
+func (r *OrderRepository) ListLatest(ctx context.Context, limit int) ([]domain.Order, error) {
+	if limit <= 0 {
+		return []domain.Order{}, nil
+	}
+
+	ids, err := r.ListOrderUIDs(ctx, limit, 0)
+	if err != nil {
+		return nil, fmt.Errorf("list latest ids: %w", err)
+	}
+
+	out := make([]domain.Order, 0, len(ids))
+	for _, id := range ids {
+		o, err := r.GetByID(ctx, id)
+		if err != nil {
+			continue
+		}
+		out = append(out, o)
+	}
+
+	return out, nil
+}
+
+func (r *OrderRepository) CountOrders(ctx context.Context) (int, error) {
+	var n int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders`).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *OrderRepository) ListOrderUIDs(ctx context.Context, limit, offset int) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT order_uid
+		FROM orders
+		ORDER BY date_created DESC, order_uid ASC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		out = append(out, uid)
+	}
+	return out, rows.Err()
+}
+
+var _ outbound.OrderRepository = (*OrderRepository)(nil)
@@ -0,0 +1,45 @@
+package sqlite_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"demo_service/internal/adapters/outbound/repotest"
+	"demo_service/internal/adapters/outbound/sqlite"
+	"demo_service/internal/migrations"
+	"demo_service/internal/ports/outbound"
+)
+
+// newRepository opens a migrated database in a fresh temporary directory.
+func newRepository(t *testing.T) *sqlite.OrderRepository {
+	t.Helper()
+	db, err := sqlite.New(t.Context(), filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	if err := sqlite.RunMigrations(t.Context(), db.SQL, migrations.SQLiteFS()); err != nil {
+		t.Fatal(err)
+	}
+	return sqlite.NewOrderRepository(db.SQL)
+}
+
+func TestOrderRepository(t *testing.T) {
+	repotest.TestOrderRepository(t, func(t *testing.T) outbound.OrderRepository {
+		return newRepository(t)
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	repotest.TestOutbox(t, func(t *testing.T) repotest.OutboxRepository {
+		repo := newRepository(t)
+		repo.EnableOutbox()
+		return repo
+	})
+}
+
+func TestLedger(t *testing.T) {
+	repotest.TestLedger(t, func(t *testing.T) repotest.LedgerRepository {
+		return newRepository(t)
+	})
+}
@@ -0,0 +1,82 @@
+// Package traced decorates an order repository with a span per call, so
+// storage time shows up in the trace of the message or request behind it.
+package traced
+
+import (
+	"context"
+	"strconv"
+
+	"demo_service/internal/core/domain"
+	"demo_service/internal/core/trace"
+	"demo_service/internal/ports/outbound"
+)
+
+type OrderRepository struct {
+	next    outbound.OrderRepository
+	backend string
+}
+
+// NewOrderRepository wraps next; backend prefixes the span names, e.g.
+// "postgres.UpsertMessages".
+func NewOrderRepository(next outbound.OrderRepository, backend string) *OrderRepository {
+	return &OrderRepository{next: next, backend: backend}
+}
+
+func (r *OrderRepository) start(ctx context.Context, op string, attrs ...string) (context.Context, *trace.Span) {
+	return trace.Start(ctx, r.backend+"."+op, attrs...)
+}
+
+func (r *OrderRepository) Upsert(ctx context.Context, order domain.Order) error {
+	ctx, span := r.start(ctx, "Upsert", "order_uid", order.OrderUID)
+	err := r.next.Upsert(ctx, order)
+	span.End(err)
+	return err
+}
+
+func (r *OrderRepository) UpsertBatch(ctx context.Context, orders []domain.Order) error {
+	ctx, span := r.start(ctx, "UpsertBatch", "orders", strconv.Itoa(len(orders)))
+	err := r.next.UpsertBatch(ctx, orders)
+	span.End(err)
+	return err
+}
+
+func (r *OrderRepository) UpsertMessages(ctx context.Context, msgs []domain.OrderMessage) ([]domain.OrderMessage, error) {
+	attrs := []string{"messages", strconv.Itoa(len(msgs))}
+	if len(msgs) == 1 {
+		attrs = append(attrs, "order_uid", msgs[0].Order.OrderUID)
+	}
+	ctx, span := r.start(ctx, "UpsertMessages", attrs...)
+	applied, err := r.next.UpsertMessages(ctx, msgs)
+	span.End(err)
+	return applied, err
+}
+
+func (r *OrderRepository) GetByID(ctx context.Context, orderUID string) (domain.Order, error) {
+	ctx, span := r.start(ctx, "GetByID", "order_uid", orderUID)
+	o, err := r.next.GetByID(ctx, orderUID)
+	span.End(err)
+	return o, err
+}
+
+func (r *OrderRepository) ListLatest(ctx context.Context, limit int) ([]domain.Order, error) {
+	ctx, span := r.start(ctx, "ListLatest", "limit", strconv.Itoa(limit))
+	orders, err := r.next.ListLatest(ctx, limit)
+	span.End(err)
+	return orders, err
+}
+
+func (r *OrderRepository) ListOrderUIDs(ctx context.Context, limit, offset int) ([]string, error) {
+	ctx, span := r.start(ctx, "ListOrderUIDs", "limit", strconv.Itoa(limit), "offset", strconv.Itoa(offset))
+	uids, err := r.next.ListOrderUIDs(ctx, limit, offset)
+	span.End(err)
+	return uids, err
+}
+
+func (r *OrderRepository) CountOrders(ctx context.Context) (int, error) {
+	ctx, span := r.start(ctx, "CountOrders")
+	n, err := r.next.CountOrders(ctx)
+	span.End(err)
+	return n, err
+}
+
+var _ outbound.OrderRepository = (*OrderRepository)(nil)
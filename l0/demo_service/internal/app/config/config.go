@@ -2,55 +2,319 @@ package config
 
 import (
 	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+	StorageSQLite   = "sqlite"
+)
+
 type Config struct {
-	HTTPAddr      string
+	HTTPAddr string
+	// AdminHTTPAddr serves the admin endpoints, which require AdminToken;
+	// without a token the admin listener is not started.
+	AdminHTTPAddr string
+	AdminToken    string
+
+	Storage       string
 	DatabaseURL   string
 	MigrationsDir string
+	// MigrationsOnDrift is "fail" or "warn"; see postgres.DriftPolicy.
+	MigrationsOnDrift string
+	MigrationsTimeout time.Duration
+	// MigrationsLockTimeout bounds the wait for another instance's migration
+	// lock; keep it below MigrationsTimeout to get a clear error.
+	MigrationsLockTimeout time.Duration
+
+	SQLitePath          string
+	SQLiteMigrationsDir string
+
+	DBMaxConns          int
+	DBMinConns          int
+	DBMaxConnLifetime   time.Duration
+	DBMaxConnIdleTime   time.Duration
+	DBHealthCheckPeriod time.Duration
+	DBConnectTimeout    time.Duration
+	DBPingTimeout       time.Duration
+	DBStatementTimeout  time.Duration
+	DBApplicationName   string
 
 	KafkaBrokers       []string
-	KafkaTopic         string
+	KafkaTopics        []string
+	KafkaTopicPattern  string
 	KafkaConsumerGroup string
+	KafkaDLQTopic      string
+	// KafkaDecodeMode is "strict" or "lenient"; see kafkain.Decoder.
+	KafkaDecodeMode string
+	// AvroSchemaDir holds <id>.avsc files; empty disables Avro decoding.
+	AvroSchemaDir string
+
+	// CloudEventsTypes and CloudEventsSources restrict the CloudEvents the
+	// consumer accepts; empty allows any.
+	CloudEventsTypes   []string
+	CloudEventsSources []string
+	// CloudEventsSource is the source of published order events.
+	CloudEventsSource string
+
+	KafkaTLSEnabled            bool
+	KafkaTLSCAFile             string
+	KafkaTLSCertFile           string
+	KafkaTLSKeyFile            string
+	KafkaTLSInsecureSkipVerify bool
+	// KafkaSASLMechanism is empty, plain, scram-sha-256 or scram-sha-512.
+	KafkaSASLMechanism string
+	KafkaSASLUsername  string
+	KafkaSASLPassword  string
+
+	OrderEventsTopic   string
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+	// OutboxRetention is how long sent events are kept; zero keeps them
+	// forever.
+	OutboxRetention     time.Duration
+	OutboxPruneInterval time.Duration
+
+	// LedgerRetention is how long processed messages are remembered as
+	// such; zero keeps them forever.
+	LedgerRetention     time.Duration
+	LedgerPruneInterval time.Duration
+
+	KafkaWorkers      int
+	KafkaBatchSize    int
+	KafkaBatchTimeout time.Duration
+
+	KafkaRetryMaxAttempts    int
+	KafkaRetryInitialBackoff time.Duration
+	KafkaRetryMaxBackoff     time.Duration
+	KafkaRetryJitter         float64
 
 	CacheWarmLimit int
 	KafkaMaxBytes  int
 	KafkaMinBytes  int
+	// KafkaStatusInterval is how often the lag and reader stats shown on
+	// /status are refreshed.
+	KafkaStatusInterval time.Duration
+
+	// TraceSpans selects which spans are logged: sampled, all or off.
+	TraceSpans string
 
 	ShutdownTimeout time.Duration
 }
 
-func Load() (Config, error) {
+// Load reads the configuration from the environment. Flags in args take
+// precedence over their environment counterparts.
+func Load(args []string) (Config, error) {
 	var c Config
 
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	storage := fs.String("storage", getenv("STORAGE", StoragePostgres), "order storage backend: postgres|sqlite|memory (env STORAGE)")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
 	c.HTTPAddr = getenv("APP_HTTP_ADDR", ":8081")
-	c.DatabaseURL = os.Getenv("DATABASE_URL")
-	if c.DatabaseURL == "" {
-		return Config{}, errors.New("DATABASE_URL is required")
+	c.AdminHTTPAddr = getenv("ADMIN_HTTP_ADDR", ":8082")
+	c.AdminToken = getenv("ADMIN_TOKEN", "")
+	if c.AdminToken != "" && c.AdminHTTPAddr == c.HTTPAddr {
+		return Config{}, errors.New("ADMIN_HTTP_ADDR must differ from APP_HTTP_ADDR")
+	}
+
+	c.Storage = strings.ToLower(strings.TrimSpace(*storage))
+	switch c.Storage {
+	case StoragePostgres, StorageSQLite, StorageMemory:
+	default:
+		return Config{}, fmt.Errorf("unknown storage %q (want postgres, sqlite or memory)", c.Storage)
+	}
+
+	if err := loadDatabase(&c); err != nil {
+		return Config{}, err
+	}
+
+	if err := loadKafka(&c); err != nil {
+		return Config{}, err
+	}
+
+	c.CacheWarmLimit = getenvInt("CACHE_WARM_LIMIT", 100)
+
+	c.TraceSpans = strings.ToLower(getenv("TRACE_SPANS", "sampled"))
+	switch c.TraceSpans {
+	case "sampled", "all", "off":
+	default:
+		return Config{}, fmt.Errorf("TRACE_SPANS must be sampled, all or off, got %q", c.TraceSpans)
 	}
 
-	c.MigrationsDir = getenv("MIGRATIONS_DIR", "internal/migrations")
+	c.ShutdownTimeout = getenvDuration("SHUTDOWN_TIMEOUT", 10*time.Second)
+
+	return c, nil
+}
+
+// LoadDatabase reads only the storage settings, for tools such as the
+// migrate command that do not need Kafka or HTTP.
+func LoadDatabase() (Config, error) {
+	c := Config{Storage: StoragePostgres}
+	if err := loadDatabase(&c); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
 
+// LoadKafka reads only the Kafka settings, for tools such as the dlq
+// command that do not touch the database.
+func LoadKafka() (Config, error) {
+	var c Config
+	if err := loadKafka(&c); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+func loadKafka(c *Config) error {
 	brokers := strings.TrimSpace(os.Getenv("KAFKA_BROKERS"))
 	if brokers == "" {
-		return Config{}, errors.New("KAFKA_BROKERS is required")
+		return errors.New("KAFKA_BROKERS is required")
 	}
 	c.KafkaBrokers = splitCSV(brokers)
 
-	c.KafkaTopic = getenv("KAFKA_TOPIC", "orders")
+	// comma-separated; KAFKA_TOPIC_PATTERN adds every topic matching a regexp
+	c.KafkaTopics = splitCSV(getenv("KAFKA_TOPIC", "orders"))
+	c.KafkaTopicPattern = getenv("KAFKA_TOPIC_PATTERN", "")
 	c.KafkaConsumerGroup = getenv("KAFKA_CONSUMER_GROUP", "orders-service")
+	// empty disables the dead-letter topic: bad messages are logged and skipped
+	c.KafkaDLQTopic = getenv("KAFKA_DLQ_TOPIC", "")
+
+	c.KafkaDecodeMode = strings.ToLower(getenv("KAFKA_DECODE_MODE", "strict"))
+	if c.KafkaDecodeMode != "strict" && c.KafkaDecodeMode != "lenient" {
+		return fmt.Errorf("KAFKA_DECODE_MODE must be strict or lenient, got %q", c.KafkaDecodeMode)
+	}
+
+	c.AvroSchemaDir = getenv("AVRO_SCHEMA_DIR", "")
+
+	c.CloudEventsTypes = splitCSV(getenv("CLOUDEVENTS_ALLOWED_TYPES", ""))
+	c.CloudEventsSources = splitCSV(getenv("CLOUDEVENTS_ALLOWED_SOURCES", ""))
+	c.CloudEventsSource = getenv("CLOUDEVENTS_SOURCE", "demo_service")
+
+	c.KafkaTLSEnabled = getenvBool("KAFKA_TLS_ENABLED", false)
+	c.KafkaTLSCAFile = getenv("KAFKA_TLS_CA_FILE", "")
+	c.KafkaTLSCertFile = getenv("KAFKA_TLS_CERT_FILE", "")
+	c.KafkaTLSKeyFile = getenv("KAFKA_TLS_KEY_FILE", "")
+	c.KafkaTLSInsecureSkipVerify = getenvBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false)
+	if (c.KafkaTLSCertFile == "") != (c.KafkaTLSKeyFile == "") {
+		return errors.New("KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE must be set together")
+	}
+	c.KafkaSASLMechanism = strings.ToLower(getenv("KAFKA_SASL_MECHANISM", ""))
+	switch c.KafkaSASLMechanism {
+	case "":
+	case "plain", "scram-sha-256", "scram-sha-512":
+		c.KafkaSASLUsername = getenv("KAFKA_SASL_USERNAME", "")
+		// not trimmed: a password may legitimately start or end with spaces
+		c.KafkaSASLPassword = os.Getenv("KAFKA_SASL_PASSWORD")
+		if c.KafkaSASLUsername == "" {
+			return errors.New("KAFKA_SASL_USERNAME is required with KAFKA_SASL_MECHANISM")
+		}
+	default:
+		return fmt.Errorf("KAFKA_SASL_MECHANISM must be plain, scram-sha-256 or scram-sha-512, got %q", c.KafkaSASLMechanism)
+	}
+
+	// empty disables the outbox: no order events are recorded or published
+	c.OrderEventsTopic = getenv("ORDER_EVENTS_TOPIC", "")
+	c.OutboxPollInterval = getenvDuration("OUTBOX_POLL_INTERVAL", time.Second)
+	c.OutboxBatchSize = getenvInt("OUTBOX_BATCH_SIZE", 100)
+	if c.OutboxBatchSize < 1 {
+		return errors.New("OUTBOX_BATCH_SIZE must be at least 1")
+	}
+	c.OutboxRetention = getenvDuration("OUTBOX_RETENTION", 7*24*time.Hour)
+	if c.OutboxRetention < 0 {
+		return errors.New("OUTBOX_RETENTION must not be negative")
+	}
+	c.OutboxPruneInterval = getenvDuration("OUTBOX_PRUNE_INTERVAL", time.Hour)
+	if c.OutboxPruneInterval <= 0 {
+		return errors.New("OUTBOX_PRUNE_INTERVAL must be positive")
+	}
+
+	// keep it longer than the topics' retention: a message redelivered
+	// after its ledger entry was pruned is applied again
+	c.LedgerRetention = getenvDuration("LEDGER_RETENTION", 14*24*time.Hour)
+	if c.LedgerRetention < 0 {
+		return errors.New("LEDGER_RETENTION must not be negative")
+	}
+	c.LedgerPruneInterval = getenvDuration("LEDGER_PRUNE_INTERVAL", time.Hour)
+	if c.LedgerPruneInterval <= 0 {
+		return errors.New("LEDGER_PRUNE_INTERVAL must be positive")
+	}
+
+	c.KafkaWorkers = getenvInt("KAFKA_WORKERS", 4)
+	if c.KafkaWorkers < 1 {
+		return errors.New("KAFKA_WORKERS must be at least 1")
+	}
+	// 0 or 1 processes messages one by one
+	c.KafkaBatchSize = getenvInt("KAFKA_BATCH_SIZE", 0)
+	c.KafkaBatchTimeout = getenvDuration("KAFKA_BATCH_TIMEOUT", 100*time.Millisecond)
+
+	c.KafkaRetryMaxAttempts = getenvInt("KAFKA_RETRY_MAX_ATTEMPTS", 5)
+	if c.KafkaRetryMaxAttempts < 1 {
+		return errors.New("KAFKA_RETRY_MAX_ATTEMPTS must be at least 1")
+	}
+	c.KafkaRetryInitialBackoff = getenvDuration("KAFKA_RETRY_INITIAL_BACKOFF", 200*time.Millisecond)
+	c.KafkaRetryMaxBackoff = getenvDuration("KAFKA_RETRY_MAX_BACKOFF", 30*time.Second)
+	c.KafkaRetryJitter = getenvFloat("KAFKA_RETRY_JITTER", 0.2)
+	if c.KafkaRetryJitter < 0 || c.KafkaRetryJitter > 1 {
+		return errors.New("KAFKA_RETRY_JITTER must be between 0 and 1")
+	}
 
-	c.CacheWarmLimit = getenvInt("CACHE_WARM_LIMIT", 100)
 	c.KafkaMinBytes = getenvInt("KAFKA_MIN_BYTES", 1e3)
 	c.KafkaMaxBytes = getenvInt("KAFKA_MAX_BYTES", 10e6)
 
-	c.ShutdownTimeout = getenvDuration("SHUTDOWN_TIMEOUT", 10*time.Second)
+	c.KafkaStatusInterval = getenvDuration("KAFKA_STATUS_INTERVAL", 15*time.Second)
+	if c.KafkaStatusInterval <= 0 {
+		return errors.New("KAFKA_STATUS_INTERVAL must be positive")
+	}
 
-	return c, nil
+	return nil
+}
+
+func loadDatabase(c *Config) error {
+	c.DatabaseURL = os.Getenv("DATABASE_URL")
+	if c.DatabaseURL == "" && c.Storage == StoragePostgres {
+		return errors.New("DATABASE_URL is required")
+	}
+
+	// empty means the migrations embedded in the binary; set a directory to
+	// iterate on SQL files without rebuilding
+	c.MigrationsDir = getenv("MIGRATIONS_DIR", "")
+	c.MigrationsOnDrift = strings.ToLower(getenv("MIGRATIONS_ON_DRIFT", "fail"))
+	if c.MigrationsOnDrift != "fail" && c.MigrationsOnDrift != "warn" {
+		return fmt.Errorf("MIGRATIONS_ON_DRIFT must be fail or warn, got %q", c.MigrationsOnDrift)
+	}
+	c.MigrationsTimeout = getenvDuration("MIGRATIONS_TIMEOUT", 30*time.Second)
+	c.MigrationsLockTimeout = getenvDuration("MIGRATIONS_LOCK_TIMEOUT", 20*time.Second)
+
+	c.SQLitePath = getenv("SQLITE_PATH", "orders.db")
+	c.SQLiteMigrationsDir = getenv("SQLITE_MIGRATIONS_DIR", "")
+
+	c.DBMaxConns = getenvInt("DB_MAX_CONNS", 10)
+	c.DBMinConns = getenvInt("DB_MIN_CONNS", 2)
+	if c.DBMaxConns <= 0 {
+		return errors.New("DB_MAX_CONNS must be positive")
+	}
+	if c.DBMinConns < 0 || c.DBMinConns > c.DBMaxConns {
+		return errors.New("DB_MIN_CONNS must be between 0 and DB_MAX_CONNS")
+	}
+	c.DBMaxConnLifetime = getenvDuration("DB_MAX_CONN_LIFETIME", 30*time.Minute)
+	c.DBMaxConnIdleTime = getenvDuration("DB_MAX_CONN_IDLE_TIME", 30*time.Minute)
+	c.DBHealthCheckPeriod = getenvDuration("DB_HEALTH_CHECK_PERIOD", 30*time.Second)
+	c.DBConnectTimeout = getenvDuration("DB_CONNECT_TIMEOUT", 0)
+	c.DBPingTimeout = getenvDuration("DB_PING_TIMEOUT", 5*time.Second)
+	c.DBStatementTimeout = getenvDuration("DB_STATEMENT_TIMEOUT", 0)
+	c.DBApplicationName = getenv("DB_APPLICATION_NAME", "demo_service")
+
+	return nil
 }
 
 func getenv(key, def string) string {
@@ -85,6 +349,30 @@ func getenvDuration(key string, def time.Duration) time.Duration {
 	return d
 }
 
+func getenvBool(key string, def bool) bool {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+func getenvFloat(key string, def float64) float64 {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
 func splitCSV(s string) []string {
 	parts := strings.Split(s, ",")
 	out := make([]string, 0, len(parts))
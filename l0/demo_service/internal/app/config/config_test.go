@@ -0,0 +1,29 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"demo_service/internal/app/config"
+)
+
+func TestLoadTraceSpans(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "localhost:9092")
+	t.Setenv("DATABASE_URL", "postgres://localhost/orders")
+
+	for _, mode := range []string{"sampled", "ALL", "off"} {
+		t.Setenv("TRACE_SPANS", mode)
+		c, err := config.Load(nil)
+		if err != nil {
+			t.Fatalf("TRACE_SPANS=%s: %v", mode, err)
+		}
+		if c.TraceSpans != strings.ToLower(mode) {
+			t.Errorf("TRACE_SPANS=%s loaded as %q", mode, c.TraceSpans)
+		}
+	}
+
+	t.Setenv("TRACE_SPANS", "verbose")
+	if _, err := config.Load(nil); err == nil || !strings.Contains(err.Error(), "TRACE_SPANS") {
+		t.Fatalf("TRACE_SPANS=verbose: error %v, want one naming TRACE_SPANS", err)
+	}
+}
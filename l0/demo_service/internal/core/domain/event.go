@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// Order event types published to downstream consumers.
+const (
+	EventOrderCreated = "order.created"
+	EventOrderUpdated = "order.updated"
+)
+
+// OrderEvent is an outbox entry: a stored order change waiting to be
+// published. ID grows monotonically, so ordering by it keeps the events of
+// one order in the order they happened.
+type OrderEvent struct {
+	ID        int64
+	Type      string
+	OrderUID  string
+	Payload   []byte // the order as JSON, as of the change
+	CreatedAt time.Time
+	Attempts  int
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "fmt"
+
+// MessageRef identifies the broker message an order was read from.
+type MessageRef struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	// ID is a producer-assigned message id, when the message carries one.
+	// It identifies the message across re-publishes, which get new offsets.
+	ID string
+}
+
+// LedgerKey is the processed-message ledger key: the message id when
+// there is one, its topic/partition/offset otherwise.
+func (r MessageRef) LedgerKey() string {
+	if r.ID != "" {
+		return "id:" + r.ID
+	}
+	return fmt.Sprintf("%s/%d/%d", r.Topic, r.Partition, r.Offset)
+}
+
+// OrderMessage is an order together with the message that carried it.
+type OrderMessage struct {
+	Ref   MessageRef
+	Order Order
+}
@@ -24,6 +24,12 @@ type Order struct {
 	SmID              int       `json:"sm_id"`
 	DateCreated       time.Time `json:"date_created"`
 	OofShard          string    `json:"oof_shard"`
+
+	// SourceTopic is the broker topic the current version of the order was
+	// read from. It is set by the consumer, never taken from the payload,
+	// and left out of the order's JSON; the HTTP API adds it to its
+	// responses.
+	SourceTopic string `json:"-"`
 }
 
 type Delivery struct {
@@ -32,6 +32,42 @@ func (s *OrderService) Ingest(ctx context.Context, order domain.Order) error {
 	return nil
 }
 
+// IngestMessages validates and stores orders read from a broker in one
+// repository transaction; any invalid order fails the whole batch before
+// anything is written. The repository records each message in its ledger
+// in the same transaction, so a redelivered message is skipped instead of
+// applied again. It returns the refs of such duplicates.
+func (s *OrderService) IngestMessages(ctx context.Context, msgs []domain.OrderMessage) ([]domain.MessageRef, error) {
+	for _, m := range msgs {
+		if err := m.Order.Validate(); err != nil {
+			return nil, fmt.Errorf("validate %s: %w", m.Order.OrderUID, err)
+		}
+	}
+
+	applied, err := s.repo.UpsertMessages(ctx, msgs)
+	if err != nil {
+		return nil, fmt.Errorf("db upsert messages: %w", err)
+	}
+
+	orders := make([]domain.Order, 0, len(applied))
+	for _, m := range applied {
+		orders = append(orders, m.Order)
+	}
+	s.cache.BulkSet(ctx, orders)
+
+	// applied is the subsequence of msgs that was written
+	var dups []domain.MessageRef
+	j := 0
+	for _, m := range msgs {
+		if j < len(applied) && applied[j].Ref == m.Ref {
+			j++
+			continue
+		}
+		dups = append(dups, m.Ref)
+	}
+	return dups, nil
+}
+
 func (s *OrderService) GetByID(ctx context.Context, orderUID string) (domain.Order, error) {
 	if orderUID == "" {
 		return domain.Order{}, domain.ErrNotFound
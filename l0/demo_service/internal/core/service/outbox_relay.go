@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"demo_service/internal/ports/outbound"
+)
+
+// OutboxRelay moves order events from the repository's outbox to the
+// event publisher, oldest first. Failed batches stay in the outbox and are
+// retried with a growing delay, so events are delivered at least once and
+// never out of order.
+type OutboxRelay struct {
+	store    outbound.OutboxStore
+	pub      outbound.EventPublisher
+	interval time.Duration
+	batch    int
+
+	sent     atomic.Uint64
+	failures atomic.Uint64
+}
+
+const maxRelayBackoff = 30 * time.Second
+
+func NewOutboxRelay(store outbound.OutboxStore, pub outbound.EventPublisher, interval time.Duration, batch int) *OutboxRelay {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if batch <= 0 {
+		batch = 100
+	}
+	return &OutboxRelay{store: store, pub: pub, interval: interval, batch: batch}
+}
+
+// OutboxStats are counters since the relay was created.
+type OutboxStats struct {
+	Sent     uint64 `json:"sent"`
+	Failures uint64 `json:"failures"`
+}
+
+func (r *OutboxRelay) Stats() OutboxStats {
+	return OutboxStats{Sent: r.sent.Load(), Failures: r.failures.Load()}
+}
+
+// Run polls the outbox until ctx is cancelled. A full batch is followed
+// immediately by the next one, so a backlog drains without waiting.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	backoff := r.interval
+	for {
+		n, err := r.store.ProcessOutbox(ctx, r.batch, r.pub.PublishOrderEvents)
+		r.sent.Add(uint64(n))
+
+		wait := r.interval
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+			r.failures.Add(1)
+			backoff = min(backoff*2, maxRelayBackoff)
+			wait = backoff
+			log.Printf("[outbox] relay failed, retry in %s: %v", wait, err)
+		case n == r.batch:
+			backoff = r.interval
+			wait = 0
+		default:
+			backoff = r.interval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
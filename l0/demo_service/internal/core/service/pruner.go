@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// PruneFunc deletes up to limit rows older than cutoff and returns how
+// many it deleted.
+type PruneFunc func(ctx context.Context, cutoff time.Time, limit int) (int, error)
+
+// Pruner deletes rows older than a retention period on an interval, in
+// batches of pruneBatch so no single delete holds its locks for long.
+type Pruner struct {
+	name      string
+	prune     PruneFunc
+	retention time.Duration
+	interval  time.Duration
+
+	deleted  atomic.Uint64
+	failures atomic.Uint64
+}
+
+const pruneBatch = 1000
+
+// NewPruner returns a pruner logging as name, e.g. "ledger".
+func NewPruner(name string, prune PruneFunc, retention, interval time.Duration) *Pruner {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &Pruner{name: name, prune: prune, retention: retention, interval: interval}
+}
+
+// PrunerStats are counters since the pruner was created.
+type PrunerStats struct {
+	Retention string `json:"retention"`
+	Deleted   uint64 `json:"deleted"`
+	Failures  uint64 `json:"failures"`
+}
+
+func (p *Pruner) Stats() PrunerStats {
+	return PrunerStats{Retention: p.retention.String(), Deleted: p.deleted.Load(), Failures: p.failures.Load()}
+}
+
+// Run prunes once right away and then every interval until ctx is
+// cancelled.
+func (p *Pruner) Run(ctx context.Context) {
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		if n, err := p.PruneOnce(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.failures.Add(1)
+			log.Printf("[%s] prune failed after %d rows: %v", p.name, n, err)
+		} else if n > 0 {
+			log.Printf("[%s] pruned %d rows older than %s", p.name, n, p.retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// PruneOnce deletes every row older than the retention period, batch by
+// batch, and returns how many it deleted.
+func (p *Pruner) PruneOnce(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-p.retention)
+	total := 0
+	for {
+		n, err := p.prune(ctx, cutoff, pruneBatch)
+		total += n
+		p.deleted.Add(uint64(n))
+		if err != nil || n < pruneBatch {
+			return total, err
+		}
+	}
+}
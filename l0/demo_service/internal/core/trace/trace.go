@@ -0,0 +1,240 @@
+// Package trace carries W3C Trace Context and correlation ids through a
+// context.Context and records spans as log lines, so one order can be
+// followed from the upstream producer through ingestion and storage.
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID    string // 32 lower-case hex digits
+	SpanID     string // 16 lower-case hex digits
+	Sampled    bool
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+var errTraceparent = errors.New("malformed traceparent")
+
+// ParseTraceparent parses a traceparent header value. Versions above 00
+// are accepted as long as they start with the version 00 fields.
+func ParseTraceparent(v string) (SpanContext, error) {
+	v = strings.TrimSpace(v)
+	if len(v) < 55 || (len(v) > 55 && v[55] != '-') {
+		return SpanContext{}, errTraceparent
+	}
+	parts := strings.Split(v[:55], "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, errTraceparent
+	}
+	for _, p := range parts {
+		if !isLowerHex(p) {
+			return SpanContext{}, errTraceparent
+		}
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(v) != 55) {
+		return SpanContext{}, errTraceparent
+	}
+	if allZero(parts[1]) || allZero(parts[2]) {
+		return SpanContext{}, errTraceparent
+	}
+
+	flags, _ := hex.DecodeString(parts[3])
+	return SpanContext{TraceID: parts[1], SpanID: parts[2], Sampled: flags[0]&1 == 1}, nil
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-" + flags
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func allZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+type spanKey struct{}
+type correlationKey struct{}
+
+// ContextWithRemote makes sc, received from upstream, the parent of spans
+// started from the returned context.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// FromContext returns the current span context, if any.
+func FromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanKey{}).(SpanContext)
+	return sc
+}
+
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// LogFields formats the trace and correlation ids of ctx for a log line,
+// e.g. "trace_id=4bf9… span_id=00f0… correlation_id=abc". It is empty
+// for a context without either.
+func LogFields(ctx context.Context) string {
+	var b strings.Builder
+	if sc := FromContext(ctx); sc.IsValid() {
+		fmt.Fprintf(&b, "trace_id=%s span_id=%s", sc.TraceID, sc.SpanID)
+	}
+	if id := CorrelationID(ctx); id != "" {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "correlation_id=%s", id)
+	}
+	return b.String()
+}
+
+// Span logging modes; see SetSpanLogging.
+const (
+	SpansSampled = "sampled" // log spans of traces sampled upstream
+	SpansAll     = "all"
+	SpansOff     = "off"
+)
+
+var spanLogging atomic.Value // string
+
+// SetSpanLogging selects which finished spans are logged. The default is
+// SpansSampled, which honors the upstream sampling decision.
+func SetSpanLogging(mode string) error {
+	switch mode {
+	case SpansSampled, SpansAll, SpansOff:
+		spanLogging.Store(mode)
+		return nil
+	}
+	return fmt.Errorf("unknown span logging mode %q (want sampled, all or off)", mode)
+}
+
+// Span is an operation within a trace.
+type Span struct {
+	ctx    context.Context
+	name   string
+	sc     SpanContext
+	parent string
+	start  time.Time
+	attrs  []string
+	links  []SpanContext
+}
+
+// Start begins a span named name as a child of the span in ctx, or as the
+// root of a new unsampled trace. attrs are key, value pairs.
+func Start(ctx context.Context, name string, attrs ...string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	sc := SpanContext{SpanID: newID(8)}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newID(16)
+	}
+
+	ctx = context.WithValue(ctx, spanKey{}, sc)
+	return ctx, &Span{ctx: ctx, name: name, sc: sc, parent: parent.SpanID, start: time.Now(), attrs: attrs}
+}
+
+// StartLinked starts a new trace for work done on behalf of other
+// traces, such as one transaction for the messages of a batch. It is
+// sampled if any of links is.
+func StartLinked(ctx context.Context, name string, links []SpanContext, attrs ...string) (context.Context, *Span) {
+	sc := SpanContext{TraceID: newID(16), SpanID: newID(8)}
+	var valid []SpanContext
+	for _, l := range links {
+		if l.IsValid() {
+			valid = append(valid, l)
+			sc.Sampled = sc.Sampled || l.Sampled
+		}
+	}
+
+	ctx = context.WithValue(ctx, spanKey{}, sc)
+	return ctx, &Span{ctx: ctx, name: name, sc: sc, start: time.Now(), attrs: attrs, links: valid}
+}
+
+func (s *Span) SpanContext() SpanContext { return s.sc }
+
+// End finishes the span and logs it unless span logging excludes it.
+func (s *Span) End(err error) {
+	mode, _ := spanLogging.Load().(string)
+	if mode == "" {
+		mode = SpansSampled
+	}
+	if mode == SpansOff || (mode == SpansSampled && !s.sc.Sampled) {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[span] %s trace_id=%s span_id=%s", s.name, s.sc.TraceID, s.sc.SpanID)
+	if s.parent != "" {
+		fmt.Fprintf(&b, " parent_id=%s", s.parent)
+	}
+	if id := CorrelationID(s.ctx); id != "" {
+		fmt.Fprintf(&b, " correlation_id=%s", id)
+	}
+	for i := 0; i+1 < len(s.attrs); i += 2 {
+		fmt.Fprintf(&b, " %s=%s", s.attrs[i], s.attrs[i+1])
+	}
+	if len(s.links) > 0 {
+		ids := make([]string, len(s.links))
+		for i, l := range s.links {
+			ids[i] = l.TraceID
+		}
+		fmt.Fprintf(&b, " links=%s", strings.Join(ids, ","))
+	}
+	fmt.Fprintf(&b, " duration=%s", time.Since(s.start).Round(time.Microsecond))
+	if err != nil {
+		fmt.Fprintf(&b, " err=%q", err.Error())
+	}
+	log.Print(b.String())
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	for {
+		for i := 0; i < n; i += 8 {
+			v := rand.Uint64()
+			for j := 0; j < 8 && i+j < n; j++ {
+				b[i+j] = byte(v >> (8 * j))
+			}
+		}
+		if id := hex.EncodeToString(b); !allZero(id) {
+			return id
+		}
+	}
+}
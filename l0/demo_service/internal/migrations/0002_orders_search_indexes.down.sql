@@ -0,0 +1,3 @@
+-- migrate:no-transaction
+DROP INDEX CONCURRENTLY IF EXISTS idx_orders_customer_id;
+DROP INDEX CONCURRENTLY IF EXISTS idx_orders_track_number;
@@ -0,0 +1,8 @@
+-- migrate:no-transaction
+-- Built concurrently so the orders table stays writable while indexing.
+-- A failed concurrent build leaves an INVALID index behind, which IF NOT
+-- EXISTS would keep; dropping first makes a retry build it again.
+DROP INDEX CONCURRENTLY IF EXISTS idx_orders_track_number;
+CREATE INDEX CONCURRENTLY idx_orders_track_number ON orders(track_number);
+DROP INDEX CONCURRENTLY IF EXISTS idx_orders_customer_id;
+CREATE INDEX CONCURRENTLY idx_orders_customer_id ON orders(customer_id);
@@ -0,0 +1,13 @@
+-- Ledger of ingested broker messages, written in the same transaction as
+-- the order upsert so a redelivered message is recognized and skipped.
+CREATE TABLE IF NOT EXISTS processed_messages (
+  message_key   TEXT PRIMARY KEY,
+  topic         TEXT NOT NULL,
+  "partition"   INT NOT NULL,
+  "offset"      BIGINT NOT NULL,
+  message_id    TEXT NOT NULL DEFAULT '',
+  order_uid     TEXT NOT NULL,
+  processed_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages(processed_at);
@@ -0,0 +1,14 @@
+-- Order events waiting to be published; written in the same transaction
+-- as the order change and drained in id order by the outbox relay.
+CREATE TABLE IF NOT EXISTS outbox (
+  id          BIGSERIAL PRIMARY KEY,
+  event_type  TEXT NOT NULL,
+  order_uid   TEXT NOT NULL,
+  payload     JSONB NOT NULL,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  sent_at     TIMESTAMPTZ,
+  attempts    INT NOT NULL DEFAULT 0,
+  last_error  TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE sent_at IS NULL;
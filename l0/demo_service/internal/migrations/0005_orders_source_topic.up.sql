@@ -0,0 +1,2 @@
+-- Topic the current version of each order was consumed from.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS source_topic TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- A relay claims a batch for claimed_until before publishing it outside
+-- any transaction; claim_id tells its own claim from a later one.
+ALTER TABLE outbox
+  ADD COLUMN IF NOT EXISTS claim_id      BIGINT,
+  ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+-- migrate:no-transaction
+-- Lets sent events be pruned by age without a full scan.
+DROP INDEX CONCURRENTLY IF EXISTS idx_outbox_sent_at;
+CREATE INDEX CONCURRENTLY idx_outbox_sent_at ON outbox(sent_at) WHERE sent_at IS NOT NULL;
@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// File is one NNNN_name.up.sql or NNNN_name.down.sql file of a migration
+// set. Both the postgres and the sqlite runner read their sets with
+// ReadFiles; what they do with the down files is up to them.
+type File struct {
+	Version int64
+	Name    string
+	Up      bool
+	SQL     string
+}
+
+// ReadFiles returns the migration files at the root of fsys by version,
+// up before down. Other files are ignored; a .sql file whose name does not
+// start with a version is an error.
+func ReadFiles(fsys fs.FS) ([]File, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("readdir: %w", err)
+	}
+
+	var files []File
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+
+		var up bool
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			up = true
+		case strings.HasSuffix(name, ".down.sql"):
+		default:
+			continue
+		}
+
+		version, ok := ParseVersion(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid migration filename: %s (expected like 0001_name.up.sql)", name)
+		}
+
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		files = append(files, File{Version: version, Name: name, Up: up, SQL: string(b)})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Version != files[j].Version {
+			return files[i].Version < files[j].Version
+		}
+		return files[i].Up && !files[j].Up
+	})
+	return files, nil
+}
+
+// ParseVersion returns the version prefix of a migration file name, the
+// digits before the first underscore.
+func ParseVersion(filename string) (int64, bool) {
+	parts := strings.SplitN(filename, "_", 2)
+	if len(parts) < 2 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
@@ -0,0 +1,55 @@
+package migrations_test
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"demo_service/internal/migrations"
+)
+
+func TestReadFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_c.up.sql":   {Data: []byte("c")},
+		"0002_b.down.sql": {Data: []byte("b down")},
+		"0002_b.up.sql":   {Data: []byte("b")},
+		"0001_a.up.sql":   {Data: []byte("a")},
+		"notes.txt":       {Data: []byte("ignored")},
+		"sqlite/x.up.sql": {Data: []byte("in a subdirectory")},
+	}
+	files, err := migrations.ReadFiles(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range files {
+		got = append(got, f.Name)
+	}
+	want := "0001_a.up.sql 0002_b.up.sql 0002_b.down.sql 0010_c.up.sql"
+	if strings.Join(got, " ") != want {
+		t.Errorf("files %v, want %s", got, want)
+	}
+	if f := files[2]; f.Version != 2 || f.Up || f.SQL != "b down" {
+		t.Errorf("down file read as %+v", f)
+	}
+}
+
+func TestReadFilesBadName(t *testing.T) {
+	for _, name := range []string{"init.up.sql", "v1_init.up.sql", "0001.up.sql"} {
+		_, err := migrations.ReadFiles(fstest.MapFS{name: {Data: []byte("x")}})
+		if err == nil || !strings.Contains(err.Error(), "invalid migration filename") {
+			t.Errorf("%s: error %v", name, err)
+		}
+	}
+}
+
+func TestEmbeddedSetsParse(t *testing.T) {
+	for name, fsys := range map[string]fs.FS{"postgres": migrations.FS(), "sqlite": migrations.SQLiteFS()} {
+		files, err := migrations.ReadFiles(fsys)
+		if err != nil || len(files) == 0 {
+			t.Errorf("%s: %d files, err %v", name, len(files), err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql sqlite/*.sql
+var fsys embed.FS
+
+// FS returns the postgres migration set.
+func FS() fs.FS {
+	return fsys
+}
+
+// SQLiteFS returns the sqlite migration set.
+func SQLiteFS() fs.FS {
+	f, err := fs.Sub(fsys, "sqlite")
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS processed_messages (
+  message_key   TEXT PRIMARY KEY,
+  topic         TEXT NOT NULL,
+  "partition"   INTEGER NOT NULL,
+  "offset"      INTEGER NOT NULL,
+  message_id    TEXT NOT NULL DEFAULT '',
+  order_uid     TEXT NOT NULL,
+  processed_at  INTEGER NOT NULL -- unix microseconds
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS outbox (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  event_type  TEXT NOT NULL,
+  order_uid   TEXT NOT NULL,
+  payload     TEXT NOT NULL,
+  created_at  INTEGER NOT NULL, -- unix microseconds
+  sent_at     INTEGER,
+  attempts    INTEGER NOT NULL DEFAULT 0,
+  last_error  TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE sent_at IS NULL;
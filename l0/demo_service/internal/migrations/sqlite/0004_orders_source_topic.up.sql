@@ -0,0 +1 @@
+ALTER TABLE orders ADD COLUMN source_topic TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Lets the ledger be pruned by age without a full scan.
+CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages(processed_at);
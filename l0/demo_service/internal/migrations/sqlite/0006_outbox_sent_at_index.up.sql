@@ -0,0 +1,2 @@
+-- Lets sent events be pruned by age without a full scan.
+CREATE INDEX IF NOT EXISTS idx_outbox_sent_at ON outbox(sent_at) WHERE sent_at IS NOT NULL;
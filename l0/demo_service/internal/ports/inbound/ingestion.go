@@ -0,0 +1,9 @@
+package inbound
+
+// IngestionControl lets operators stop and restart message ingestion, e.g.
+// for a database maintenance window, without stopping the process.
+type IngestionControl interface {
+	PauseIngestion()
+	ResumeIngestion()
+	IngestionPaused() bool
+}
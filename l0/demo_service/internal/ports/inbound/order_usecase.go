@@ -8,6 +8,7 @@ import (
 type OrderUseCase interface {
 	GetByID(ctx context.Context, orderUID string) (domain.Order, error)
 	Ingest(ctx context.Context, order domain.Order) error
+	IngestMessages(ctx context.Context, msgs []domain.OrderMessage) (duplicates []domain.MessageRef, err error)
 	WarmCache(ctx context.Context, limit int) (int, error)
 	ListPage(ctx context.Context, page, pageSize int) (orders []domain.Order, total int, err error)
 }
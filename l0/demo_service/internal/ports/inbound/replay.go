@@ -0,0 +1,50 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrReplayRunning = errors.New("a replay is already running")
+	ErrInvalidReplay = errors.New("invalid replay request")
+)
+
+// ReplayRequest selects the history to feed through ingestion again.
+type ReplayRequest struct {
+	Topic      string    `json:"topic"`
+	Partition  int       `json:"partition"` // -1 for all partitions
+	FromOffset int64     `json:"from_offset"`
+	FromTime   time.Time `json:"from_time,omitzero"` // wins over FromOffset when set
+	Rate       float64   `json:"rate"`               // messages per second; 0 is unlimited
+}
+
+type ReplayPartition struct {
+	Partition int   `json:"partition"`
+	From      int64 `json:"from"`
+	End       int64 `json:"end"`  // high watermark when the replay started
+	Next      int64 `json:"next"` // next offset to replay; the partition is done at End
+}
+
+type ReplayStatus struct {
+	Running    bool              `json:"running"`
+	Request    *ReplayRequest    `json:"request,omitempty"`
+	StartedAt  time.Time         `json:"started_at,omitzero"`
+	FinishedAt time.Time         `json:"finished_at,omitzero"`
+	Partitions []ReplayPartition `json:"partitions,omitempty"`
+	Replayed   int64             `json:"replayed"`
+	Failed     int64             `json:"failed"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Replayer re-reads past broker messages into ingestion, independently of
+// the live consumer. Only one replay runs at a time.
+type Replayer interface {
+	// StartReplay validates req and starts the replay in the background;
+	// it returns ErrReplayRunning if one is in progress.
+	StartReplay(ctx context.Context, req ReplayRequest) error
+	// CancelReplay stops the running replay and reports whether there was one.
+	CancelReplay() bool
+	ReplayStatus() ReplayStatus
+}
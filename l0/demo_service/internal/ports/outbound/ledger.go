@@ -0,0 +1,15 @@
+package outbound
+
+import (
+	"context"
+	"time"
+)
+
+// LedgerStore is implemented by repositories that keep the processed-message
+// ledger behind UpsertMessages.
+type LedgerStore interface {
+	// PruneLedger deletes up to limit entries recorded before cutoff and
+	// returns how many it deleted. A message whose entry is gone is no
+	// longer recognized as a duplicate.
+	PruneLedger(ctx context.Context, cutoff time.Time, limit int) (int, error)
+}
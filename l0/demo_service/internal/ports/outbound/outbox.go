@@ -0,0 +1,25 @@
+package outbound
+
+import (
+	"context"
+	"time"
+
+	"demo_service/internal/core/domain"
+)
+
+// OutboxStore is implemented by repositories that write an OrderEvent in
+// the same transaction as every order they store.
+type OutboxStore interface {
+	// ProcessOutbox passes up to limit unsent events, oldest first, to
+	// publish. When publish succeeds they are marked sent; otherwise the
+	// failed attempt is recorded and they stay pending for the next call.
+	// It returns how many events were sent.
+	ProcessOutbox(ctx context.Context, limit int, publish func(context.Context, []domain.OrderEvent) error) (int, error)
+	// PruneOutbox deletes up to limit events sent before cutoff and
+	// returns how many it deleted. Pending events are never deleted.
+	PruneOutbox(ctx context.Context, cutoff time.Time, limit int) (int, error)
+}
+
+type EventPublisher interface {
+	PublishOrderEvents(ctx context.Context, events []domain.OrderEvent) error
+}
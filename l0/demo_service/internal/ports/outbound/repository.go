@@ -8,6 +8,13 @@ import (
 
 type OrderRepository interface {
 	Upsert(ctx context.Context, order domain.Order) error
+	// UpsertBatch stores all orders atomically: if it fails, none of them
+	// were written.
+	UpsertBatch(ctx context.Context, orders []domain.Order) error
+	// UpsertMessages is UpsertBatch plus a processed-message ledger updated
+	// in the same transaction: messages whose MessageRef was seen before
+	// are skipped. It returns the messages whose orders were written.
+	UpsertMessages(ctx context.Context, msgs []domain.OrderMessage) ([]domain.OrderMessage, error)
 	GetByID(ctx context.Context, orderUID string) (domain.Order, error)
 	ListLatest(ctx context.Context, limit int) ([]domain.Order, error)
 	ListOrderUIDs(ctx context.Context, limit, offset int) ([]string, error)